@@ -0,0 +1,290 @@
+package alarm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rltvty/go-home/dmx/calendar"
+	"github.com/rltvty/go-home/dmx/default_loop"
+)
+
+//MinRamp and MaxRamp bound how long the sunrise ramp before the wake time can be
+const (
+	MinRamp = 20 * time.Minute
+	MaxRamp = 45 * time.Minute
+)
+
+const dateFormat = "2006-01-02"
+const defaultRamp = 30 * time.Minute
+const defaultHold = 30 * time.Minute
+const defaultSnooze = 9 * time.Minute
+
+//the ramp passes through these colors in equal thirds, from off
+var (
+	deepRed = default_loop.Color{Red: 120}
+	amber   = default_loop.Color{Red: 255, Green: 60, Amber: 255}
+	white   = default_loop.Color{Red: 255, Green: 200, Blue: 120, White: 255, Amber: 100}
+)
+
+//Status is the alarm's settings and state, with clock times as "15:04"
+type Status struct {
+	Ramp         string            `json:"ramp"`
+	Days         map[string]string `json:"days"`
+	Dates        map[string]string `json:"dates"`
+	Next         *time.Time        `json:"next,omitempty"`
+	Ringing      bool              `json:"ringing"`
+	SnoozedUntil *time.Time        `json:"snoozedUntil,omitempty"`
+}
+
+//Alarm is a sunrise simulation that ramps from deep red through amber to white, ending at the wake time
+type Alarm struct {
+	//Ramp is how long before the wake time the lights start, between MinRamp and MaxRamp
+	Ramp time.Duration
+	//Hold is how long the lights stay white after the wake time, unless dismissed
+	Hold time.Duration
+	//Snooze is how long the lights go back to the program when snoozed
+	Snooze time.Duration
+
+	mu           sync.Mutex
+	days         map[time.Weekday]time.Duration
+	dates        map[string]time.Duration
+	snoozedWake  time.Time
+	snoozedUntil time.Time
+	dismissed    time.Time
+}
+
+//New creates an alarm with no wake times, with optional options
+func New(options ...func(*Alarm)) *Alarm {
+	alarm := Alarm{
+		Ramp:   defaultRamp,
+		Hold:   defaultHold,
+		Snooze: defaultSnooze,
+		days:   map[time.Weekday]time.Duration{},
+		dates:  map[string]time.Duration{},
+	}
+	alarm.SetOptions(options...)
+
+	return &alarm
+}
+
+// SetOptions takes one or more option function and applies them in order to Alarm.
+func (a *Alarm) SetOptions(options ...func(*Alarm)) {
+	for _, opt := range options {
+		opt(a)
+	}
+}
+
+//ParseClock parses a wake time like "06:30" into the time since midnight
+func ParseClock(text string) (time.Duration, error) {
+	t, err := time.Parse("15:04", text)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid wake time: %s", text)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func formatClock(clock time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(clock/time.Hour), int(clock%time.Hour/time.Minute))
+}
+
+//SetRamp changes the ramp length
+func (a *Alarm) SetRamp(ramp time.Duration) error {
+	if ramp < MinRamp || ramp > MaxRamp {
+		return fmt.Errorf("Ramp must be between %s and %s", MinRamp, MaxRamp)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.Ramp = ramp
+	return nil
+}
+
+//Set sets the wake time for a day: a day name, "weekday", "weekend" or a date like "2019-12-02" for a one off
+func (a *Alarm) Set(day string, clock time.Duration) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := time.Parse(dateFormat, day); err == nil {
+		a.dates[day] = clock
+		return nil
+	}
+	weekdays, err := calendar.ParseDays(day)
+	if err != nil {
+		return errors.New("Unknown day or date: " + day)
+	}
+	for _, weekday := range weekdays {
+		a.days[weekday] = clock
+	}
+	return nil
+}
+
+//Clear removes the wake time for a day, which is named as in Set
+func (a *Alarm) Clear(day string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := time.Parse(dateFormat, day); err == nil {
+		delete(a.dates, day)
+		return nil
+	}
+	weekdays, err := calendar.ParseDays(day)
+	if err != nil {
+		return errors.New("Unknown day or date: " + day)
+	}
+	for _, weekday := range weekdays {
+		delete(a.days, weekday)
+	}
+	return nil
+}
+
+//SetWakeTimes parses a list like "weekday=06:30,sat=08:00" and sets each wake time
+func (a *Alarm) SetWakeTimes(list string) error {
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return errors.New("Invalid wake time: " + item)
+		}
+		clock, err := ParseClock(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return err
+		}
+		if err := a.Set(strings.TrimSpace(parts[0]), clock); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//wakeOn returns the wake time on the local calendar day of date, a one off time taking precedence over the weekday's
+func (a *Alarm) wakeOn(date time.Time) (time.Time, bool) {
+	local := date.Local()
+	clock, ok := a.dates[local.Format(dateFormat)]
+	if !ok {
+		clock, ok = a.days[local.Weekday()]
+	}
+	if !ok {
+		return time.Time{}, false
+	}
+	return default_loop.ClockOn(local, clock), true
+}
+
+//end is when the lights return to the program after the wake time
+func (a *Alarm) end(wake time.Time) time.Time {
+	if a.snoozedWake.Equal(wake) {
+		return a.snoozedUntil.Add(a.Hold)
+	}
+	return wake.Add(a.Hold)
+}
+
+//ringing returns the wake time of the alarm that is running at now, including while it is snoozed
+func (a *Alarm) ringing(now time.Time) (time.Time, bool) {
+	for _, day := range []time.Time{now.AddDate(0, 0, -1), now, now.AddDate(0, 0, 1)} {
+		wake, ok := a.wakeOn(day)
+		if !ok || wake.Equal(a.dismissed) {
+			continue
+		}
+		if !now.Before(wake.Add(-a.Ramp)) && now.Before(a.end(wake)) {
+			return wake, true
+		}
+	}
+	return time.Time{}, false
+}
+
+//next returns the next wake time that hasn't started or been dismissed, looking a week ahead
+func (a *Alarm) next(now time.Time) (time.Time, bool) {
+	for i := 0; i <= 7; i++ {
+		wake, ok := a.wakeOn(now.AddDate(0, 0, i))
+		if ok && !wake.Equal(a.dismissed) && now.Before(wake.Add(-a.Ramp)) {
+			return wake, true
+		}
+	}
+	return time.Time{}, false
+}
+
+//Color returns the alarm color at now, false when the alarm isn't running and the program should be shown
+func (a *Alarm) Color(now time.Time) (default_loop.Color, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	wake, ok := a.ringing(now)
+	if !ok || (a.snoozedWake.Equal(wake) && now.Before(a.snoozedUntil)) {
+		return default_loop.Color{}, false
+	}
+	if !now.Before(wake) {
+		return white, true
+	}
+
+	progress := 3 * float64(now.Sub(wake.Add(-a.Ramp))) / float64(a.Ramp)
+	switch {
+	case progress < 1:
+		return default_loop.Interpolate(default_loop.Color{}, deepRed, progress, default_loop.Perceptual), true
+	case progress < 2:
+		return default_loop.Interpolate(deepRed, amber, progress-1, default_loop.Perceptual), true
+	default:
+		return default_loop.Interpolate(amber, white, progress-2, default_loop.Perceptual), true
+	}
+}
+
+//SnoozeAt returns the lights to the program for the snooze time, after which the alarm carries on
+func (a *Alarm) SnoozeAt(now time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	wake, ok := a.ringing(now)
+	if !ok {
+		return errors.New("No alarm is running")
+	}
+	a.snoozedWake = wake
+	a.snoozedUntil = now.Add(a.Snooze)
+	return nil
+}
+
+//DismissAt stops the running alarm, or skips the next one if none is running
+func (a *Alarm) DismissAt(now time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	wake, ok := a.ringing(now)
+	if !ok {
+		wake, ok = a.next(now)
+	}
+	if !ok {
+		return errors.New("No alarm is set")
+	}
+	a.dismissed = wake
+	return nil
+}
+
+//Status returns the alarm settings, the next wake time and whether the alarm is running
+func (a *Alarm) Status(now time.Time) Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	status := Status{Ramp: a.Ramp.String(), Days: map[string]string{}, Dates: map[string]string{}}
+	for weekday, clock := range a.days {
+		status.Days[strings.ToLower(weekday.String()[:3])] = formatClock(clock)
+	}
+	for date, clock := range a.dates {
+		//past one off times are no longer interesting
+		if date >= now.Local().Format(dateFormat) {
+			status.Dates[date] = formatClock(clock)
+		}
+	}
+
+	if wake, ok := a.ringing(now); ok {
+		status.Ringing = true
+		if a.snoozedWake.Equal(wake) && now.Before(a.snoozedUntil) {
+			until := a.snoozedUntil
+			status.SnoozedUntil = &until
+		}
+	}
+	if wake, ok := a.next(now); ok {
+		status.Next = &wake
+	}
+	return status
+}
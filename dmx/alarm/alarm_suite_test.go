@@ -0,0 +1,13 @@
+package alarm_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestAlarm(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Alarm Suite")
+}
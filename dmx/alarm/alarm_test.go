@@ -0,0 +1,146 @@
+package alarm_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/rltvty/go-home/dmx/alarm"
+)
+
+//2019-12-02 is a monday
+func monday(hour int, minute int) time.Time {
+	return time.Date(2019, 12, 2, hour, minute, 0, 0, time.Local)
+}
+
+var _ = Describe("Alarm", func() {
+	var alarm *Alarm
+
+	BeforeEach(func() {
+		alarm = New()
+		Expect(alarm.SetWakeTimes("weekday=06:30, sat=08:00")).To(Succeed())
+	})
+
+	Describe("Color", func() {
+		It("should be off outside the ramp and hold", func() {
+			_, ok := alarm.Color(monday(5, 59))
+			Expect(ok).To(BeFalse())
+			_, ok = alarm.Color(monday(7, 0))
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should ramp from deep red through amber to white", func() {
+			start, ok := alarm.Color(monday(6, 0))
+			Expect(ok).To(BeTrue())
+			Expect(start.Red).To(BeNumerically("==", 0))
+
+			red, _ := alarm.Color(monday(6, 10))
+			Expect(red.Red).To(BeNumerically("==", 120))
+			Expect(red.Amber).To(BeNumerically("==", 0))
+
+			amber, _ := alarm.Color(monday(6, 20))
+			Expect(amber.Amber).To(BeNumerically("==", 255))
+			Expect(amber.White).To(BeNumerically("==", 0))
+
+			white, _ := alarm.Color(monday(6, 30))
+			Expect(white.White).To(BeNumerically("==", 255))
+			held, _ := alarm.Color(monday(6, 59))
+			Expect(held).To(Equal(white))
+		})
+
+		It("should follow the ramp length", func() {
+			Expect(alarm.SetRamp(20 * time.Minute)).To(Succeed())
+			_, ok := alarm.Color(monday(6, 5))
+			Expect(ok).To(BeFalse())
+			_, ok = alarm.Color(monday(6, 10))
+			Expect(ok).To(BeTrue())
+		})
+
+		It("should reject ramps outside 20 to 45 minutes", func() {
+			Expect(alarm.SetRamp(10 * time.Minute)).NotTo(Succeed())
+			Expect(alarm.SetRamp(time.Hour)).NotTo(Succeed())
+			Expect(alarm.Ramp).To(Equal(30 * time.Minute))
+		})
+
+		It("should use one off times over the weekday's", func() {
+			Expect(alarm.Set("2019-12-02", 5*time.Hour)).To(Succeed())
+			_, ok := alarm.Color(monday(6, 15))
+			Expect(ok).To(BeFalse())
+			_, ok = alarm.Color(monday(4, 45))
+			Expect(ok).To(BeTrue())
+		})
+
+		It("should ramp across midnight", func() {
+			Expect(alarm.Set("2019-12-03", 10*time.Minute)).To(Succeed())
+			_, ok := alarm.Color(monday(23, 50))
+			Expect(ok).To(BeTrue())
+		})
+
+		It("should not ring on days without a wake time", func() {
+			Expect(alarm.Clear("weekday")).To(Succeed())
+			_, ok := alarm.Color(monday(6, 20))
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("SnoozeAt", func() {
+		It("should pause the alarm and extend the hold", func() {
+			Expect(alarm.SnoozeAt(monday(6, 35))).To(Succeed())
+			_, ok := alarm.Color(monday(6, 40))
+			Expect(ok).To(BeFalse())
+			Expect(alarm.Status(monday(6, 40)).SnoozedUntil).NotTo(BeNil())
+
+			color, ok := alarm.Color(monday(6, 44))
+			Expect(ok).To(BeTrue())
+			Expect(color.White).To(BeNumerically("==", 255))
+			_, ok = alarm.Color(monday(7, 10))
+			Expect(ok).To(BeTrue())
+			_, ok = alarm.Color(monday(7, 14))
+			Expect(ok).To(BeFalse())
+		})
+
+		It("should error when no alarm is running", func() {
+			Expect(alarm.SnoozeAt(monday(12, 0))).To(MatchError("No alarm is running"))
+		})
+	})
+
+	Describe("DismissAt", func() {
+		It("should stop the running alarm", func() {
+			Expect(alarm.DismissAt(monday(6, 25))).To(Succeed())
+			_, ok := alarm.Color(monday(6, 26))
+			Expect(ok).To(BeFalse())
+
+			_, ok = alarm.Color(monday(6, 0).AddDate(0, 0, 1).Add(10 * time.Minute))
+			Expect(ok).To(BeTrue())
+		})
+
+		It("should skip the next alarm when none is running", func() {
+			Expect(*alarm.Status(monday(12, 0)).Next).To(Equal(monday(6, 30).AddDate(0, 0, 1)))
+			Expect(alarm.DismissAt(monday(12, 0))).To(Succeed())
+			_, ok := alarm.Color(monday(6, 20).AddDate(0, 0, 1))
+			Expect(ok).To(BeFalse())
+			Expect(*alarm.Status(monday(12, 0)).Next).To(Equal(monday(6, 30).AddDate(0, 0, 2)))
+		})
+	})
+
+	Describe("Status", func() {
+		It("should report the settings", func() {
+			Expect(alarm.Set("2019-12-24", 9*time.Hour)).To(Succeed())
+			Expect(alarm.Set("2019-11-01", 9*time.Hour)).To(Succeed())
+			status := alarm.Status(monday(6, 15))
+			Expect(status.Ramp).To(Equal("30m0s"))
+			Expect(status.Days).To(HaveLen(6))
+			Expect(status.Days["sat"]).To(Equal("08:00"))
+			Expect(status.Days["mon"]).To(Equal("06:30"))
+			Expect(status.Dates).To(Equal(map[string]string{"2019-12-24": "09:00"}))
+			Expect(status.Ringing).To(BeTrue())
+		})
+	})
+
+	It("should reject bad wake times", func() {
+		Expect(alarm.SetWakeTimes("mon=25:00")).To(MatchError("Invalid wake time: 25:00"))
+		Expect(alarm.SetWakeTimes("someday=06:00")).To(MatchError("Unknown day or date: someday"))
+		Expect(alarm.SetWakeTimes("mon")).To(MatchError("Invalid wake time: mon"))
+	})
+})
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rltvty/go-home/dmx/alarm"
+	"github.com/rltvty/go-home/dmx/clock"
+	"github.com/rltvty/go-home/dmx/control"
+	"github.com/rltvty/go-home/dmx/default_loop"
+	"github.com/rltvty/go-home/dmx/discovery"
+	"github.com/rltvty/go-home/dmx/effect"
+	"github.com/rltvty/go-home/dmx/input"
+	"github.com/rltvty/go-home/dmx/master"
+	"github.com/rltvty/go-home/dmx/notify"
+	"github.com/rltvty/go-home/dmx/presence"
+	"github.com/rltvty/go-home/logwrapper"
+)
+
+type colorRequest struct {
+	Color *default_loop.Color `json:"color"`
+	//Duration is a go duration string like "15m", empty means until resumed
+	Duration string `json:"duration"`
+}
+
+type alarmRequest struct {
+	//At is the wake time, like "06:30"
+	At string `json:"at"`
+}
+
+type rampRequest struct {
+	Ramp string `json:"ramp"`
+}
+
+type effectRequest struct {
+	effect.EffectJSON
+	//Duration is a go duration string like "30s", empty means until stopped
+	Duration string `json:"duration"`
+}
+
+type masterRequest struct {
+	Level *float64 `json:"level"`
+}
+
+type scheduleRequest struct {
+	Schedule []master.Step `json:"schedule"`
+}
+
+type modeRequest struct {
+	Mode string `json:"mode"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func getStatus(controller *control.Controller, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		writeJSON(w, http.StatusOK, controller.Status(clk.Now()))
+	}
+}
+
+func getGroups(controller *control.Controller) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		writeJSON(w, http.StatusOK, controller.Groups())
+	}
+}
+
+func putColor(controller *control.Controller, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		log := logwrapper.GetInstance()
+
+		var request colorRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.InvalidArg("body")
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if request.Color == nil {
+			log.MissingArg("color")
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "color is required"})
+			return
+		}
+
+		var duration time.Duration
+		if request.Duration != "" {
+			var err error
+			duration, err = time.ParseDuration(request.Duration)
+			if err != nil || duration < 0 {
+				log.InvalidArgValue("duration", request.Duration)
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid duration: " + request.Duration})
+				return
+			}
+		}
+
+		if err := controller.SetColor(ps.ByName("target"), *request.Color, duration, clk.Now()); err != nil {
+			log.InvalidArgValue("target", ps.ByName("target"))
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, controller.Status(clk.Now()))
+	}
+}
+
+func deleteColor(controller *control.Controller, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if err := controller.Resume(ps.ByName("target")); err != nil {
+			logwrapper.GetInstance().InvalidArgValue("target", ps.ByName("target"))
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, controller.Status(clk.Now()))
+	}
+}
+
+func postResume(controller *control.Controller, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		controller.Resume(control.AllFixtures)
+		writeJSON(w, http.StatusOK, controller.Status(clk.Now()))
+	}
+}
+
+func putEffect(controller *control.Controller, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		log := logwrapper.GetInstance()
+
+		var request effectRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.InvalidArg("body")
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		e, err := effect.Parse(request.EffectJSON)
+		if err != nil {
+			log.InvalidArgValue("kind", request.Kind)
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		var duration time.Duration
+		if request.Duration != "" {
+			duration, err = time.ParseDuration(request.Duration)
+			if err != nil || duration < 0 {
+				log.InvalidArgValue("duration", request.Duration)
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid duration: " + request.Duration})
+				return
+			}
+		}
+
+		if err := controller.StartEffect(ps.ByName("target"), *e, duration, clk.Now()); err != nil {
+			log.InvalidArgValue("target", ps.ByName("target"))
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, controller.Status(clk.Now()))
+	}
+}
+
+func deleteEffect(controller *control.Controller, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if err := controller.StopEffect(ps.ByName("target")); err != nil {
+			logwrapper.GetInstance().InvalidArgValue("target", ps.ByName("target"))
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, controller.Status(clk.Now()))
+	}
+}
+
+func postNotify(controller *control.Controller, library notify.Library, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		log := logwrapper.GetInstance()
+
+		var request notify.NotificationJSON
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.InvalidArg("body")
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		notification, err := library.Parse(request)
+		if err != nil {
+			log.InvalidArgValue("name", request.Name)
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if _, err := controller.Notify(ps.ByName("target"), *notification, clk.Now()); err != nil {
+			log.InvalidArgValue("target", ps.ByName("target"))
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, controller.Status(clk.Now()))
+	}
+}
+
+func deleteNotify(controller *control.Controller, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if err := controller.CancelNotifications(ps.ByName("target")); err != nil {
+			logwrapper.GetInstance().InvalidArgValue("target", ps.ByName("target"))
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, controller.Status(clk.Now()))
+	}
+}
+
+func getNotifications(library notify.Library) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		writeJSON(w, http.StatusOK, library)
+	}
+}
+
+func putMode(controller *control.Controller, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		log := logwrapper.GetInstance()
+
+		var request modeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.InvalidArg("body")
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if request.Mode == "" {
+			log.MissingArg("mode")
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "mode is required"})
+			return
+		}
+		controller.SetMode(request.Mode)
+		writeJSON(w, http.StatusOK, controller.Status(clk.Now()))
+	}
+}
+
+func deleteMode(controller *control.Controller, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		controller.SetMode("")
+		writeJSON(w, http.StatusOK, controller.Status(clk.Now()))
+	}
+}
+
+func getAlarm(wakeAlarm *alarm.Alarm, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		writeJSON(w, http.StatusOK, wakeAlarm.Status(clk.Now()))
+	}
+}
+
+func putAlarmRamp(wakeAlarm *alarm.Alarm, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		log := logwrapper.GetInstance()
+
+		var request rampRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.InvalidArg("body")
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		ramp, err := time.ParseDuration(request.Ramp)
+		if err == nil {
+			err = wakeAlarm.SetRamp(ramp)
+		}
+		if err != nil {
+			log.InvalidArgValue("ramp", request.Ramp)
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid ramp: " + request.Ramp})
+			return
+		}
+		writeJSON(w, http.StatusOK, wakeAlarm.Status(clk.Now()))
+	}
+}
+
+func putAlarm(wakeAlarm *alarm.Alarm, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		log := logwrapper.GetInstance()
+
+		var request alarmRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.InvalidArg("body")
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		clock, err := alarm.ParseClock(request.At)
+		if err != nil {
+			log.InvalidArgValue("at", request.At)
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := wakeAlarm.Set(ps.ByName("day"), clock); err != nil {
+			log.InvalidArgValue("day", ps.ByName("day"))
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, wakeAlarm.Status(clk.Now()))
+	}
+}
+
+func deleteAlarm(wakeAlarm *alarm.Alarm, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if err := wakeAlarm.Clear(ps.ByName("day")); err != nil {
+			logwrapper.GetInstance().InvalidArgValue("day", ps.ByName("day"))
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, wakeAlarm.Status(clk.Now()))
+	}
+}
+
+func postSnooze(wakeAlarm *alarm.Alarm, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if err := wakeAlarm.SnoozeAt(clk.Now()); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, wakeAlarm.Status(clk.Now()))
+	}
+}
+
+func postDismiss(wakeAlarm *alarm.Alarm, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if err := wakeAlarm.DismissAt(clk.Now()); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, wakeAlarm.Status(clk.Now()))
+	}
+}
+
+func getInput(merger *input.Merger, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		sources := []input.Source{}
+		if merger != nil {
+			sources = merger.Sources(clk.Now())
+		}
+		writeJSON(w, http.StatusOK, sources)
+	}
+}
+
+func getMaster(levels *master.Master, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		writeJSON(w, http.StatusOK, levels.Status(clk.Now()))
+	}
+}
+
+func putMasterSchedule(levels *master.Master, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		log := logwrapper.GetInstance()
+
+		var request scheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.InvalidArg("body")
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := levels.SetSchedule(request.Schedule); err != nil {
+			log.InvalidArg("schedule")
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, levels.Status(clk.Now()))
+	}
+}
+
+func putMaster(levels *master.Master, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		log := logwrapper.GetInstance()
+
+		var request masterRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.InvalidArg("body")
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if request.Level == nil {
+			log.MissingArg("level")
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "level is required"})
+			return
+		}
+		if _, ok := levels.Targets[ps.ByName("target")]; !ok {
+			log.InvalidArgValue("target", ps.ByName("target"))
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "Unknown fixture or group: " + ps.ByName("target")})
+			return
+		}
+		if err := levels.Set(ps.ByName("target"), *request.Level, clk.Now()); err != nil {
+			log.InvalidArg("level")
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, levels.Status(clk.Now()))
+	}
+}
+
+func deleteMaster(levels *master.Master, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if err := levels.Clear(ps.ByName("target")); err != nil {
+			logwrapper.GetInstance().InvalidArgValue("target", ps.ByName("target"))
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, levels.Status(clk.Now()))
+	}
+}
+
+func getPresence(tracker *presence.Tracker, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		writeJSON(w, http.StatusOK, tracker.Status(clk.Now()))
+	}
+}
+
+func postPresence(tracker *presence.Tracker, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		log := logwrapper.GetInstance()
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		signal, err := presence.ParseSignal(body)
+		if err != nil {
+			log.InvalidArg("body")
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := tracker.Signal(ps.ByName("zone"), signal, clk.Now()); err != nil {
+			log.InvalidArgValue("zone", ps.ByName("zone"))
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tracker.Status(clk.Now()))
+	}
+}
+
+func artNetNodes(registry *discovery.Registry, clk clock.Clock) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		writeJSON(w, http.StatusOK, registry.Nodes(clk.Now()))
+	}
+}
+
+func newRouter(controller *control.Controller, registry *discovery.Registry, wakeAlarm *alarm.Alarm, library notify.Library,
+	merger *input.Merger, tracker *presence.Tracker, levels *master.Master, clk clock.Clock) *httprouter.Router {
+	router := httprouter.New()
+	router.GET("/", index)
+	router.GET("/status", getStatus(controller, clk))
+	router.GET("/groups", getGroups(controller))
+	router.PUT("/color/:target", putColor(controller, clk))
+	router.DELETE("/color/:target", deleteColor(controller, clk))
+	router.POST("/resume", postResume(controller, clk))
+	router.PUT("/effect/:target", putEffect(controller, clk))
+	router.DELETE("/effect/:target", deleteEffect(controller, clk))
+	router.GET("/notifications", getNotifications(library))
+	router.POST("/notify/:target", postNotify(controller, library, clk))
+	router.DELETE("/notify/:target", deleteNotify(controller, clk))
+	router.PUT("/mode", putMode(controller, clk))
+	router.DELETE("/mode", deleteMode(controller, clk))
+	router.GET("/alarm", getAlarm(wakeAlarm, clk))
+	router.PUT("/alarm", putAlarmRamp(wakeAlarm, clk))
+	router.PUT("/alarm/:day", putAlarm(wakeAlarm, clk))
+	router.DELETE("/alarm/:day", deleteAlarm(wakeAlarm, clk))
+	router.POST("/alarm/snooze", postSnooze(wakeAlarm, clk))
+	router.POST("/alarm/dismiss", postDismiss(wakeAlarm, clk))
+	router.GET("/input", getInput(merger, clk))
+	router.GET("/master", getMaster(levels, clk))
+	router.PUT("/master", putMasterSchedule(levels, clk))
+	router.PUT("/master/:target", putMaster(levels, clk))
+	router.DELETE("/master/:target", deleteMaster(levels, clk))
+	router.GET("/presence", getPresence(tracker, clk))
+	router.POST("/presence/:zone", postPresence(tracker, clk))
+	router.GET("/artnet/nodes", artNetNodes(registry, clk))
+	return router
+}
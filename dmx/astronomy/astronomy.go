@@ -5,18 +5,22 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 )
 
 const astronomyURL = "https://api.sunrise-sunset.org"
-const astronomyAPIURL = "https://api.sunrise-sunset.org/json?lat=%f&lng=%f&formatted=0"
 const myLatitude = 30.262890
 const myLongitude = -97.720119
 
 //API for accessing astronomy events
 type API struct {
-	Client *http.Client
-	URL    string
+	Client    *http.Client
+	URL       string
+	Latitude  float64
+	Longitude float64
+	//Location is the time zone dates are interpreted in and events are returned in, nil leaves both to the api
+	Location *time.Location
 }
 
 //New creates the API client with optional options
@@ -25,7 +29,9 @@ func New(options ...func(*API)) *API {
 		Client: &http.Client{
 			Timeout: 5 * time.Second,
 		},
-		URL: astronomyURL,
+		URL:       astronomyURL,
+		Latitude:  myLatitude,
+		Longitude: myLongitude,
 	}
 	api.SetOptions(options...)
 
@@ -39,13 +45,32 @@ func (api *API) SetOptions(options ...func(*API)) {
 	}
 }
 
-//Events contains time info about astronomical events
+//Window is a span of time between two astronomical events
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+//Events contains time info about astronomical events.  Dawn and Dusk are the civil twilight begin and end.
 type Events struct {
-	Dawn    time.Time
-	SunRise time.Time
-	SunPeak time.Time
-	SunSet  time.Time
-	Dusk    time.Time
+	AstronomicalDawn time.Time
+	NauticalDawn     time.Time
+	Dawn             time.Time
+	SunRise          time.Time
+	SunPeak          time.Time
+	SunSet           time.Time
+	Dusk             time.Time
+	NauticalDusk     time.Time
+	AstronomicalDusk time.Time
+
+	//BlueHour is while the sun is between 6 and 4 degrees below the horizon
+	MorningBlueHour Window
+	EveningBlueHour Window
+	//GoldenHour is while the sun is between 4 degrees below and 6 degrees above the horizon
+	MorningGoldenHour Window
+	EveningGoldenHour Window
+
+	DayLength time.Duration
 }
 
 func (e Events) String() string  {
@@ -58,6 +83,45 @@ func (e Events) String() string  {
 	return fmt.Sprintf("Dawn: %s   Rise: %s   Peak: %s   Set: %s   Dusk: %s", dawn, rise, peak, set, dusk)
 }
 
+//In returns the events with every time converted to loc
+func (e Events) In(loc *time.Location) *Events {
+	return e.mapTimes(func(t time.Time) time.Time { return t.In(loc) })
+}
+
+//AddDays returns the events moved by a number of calendar days, keeping their wall clock times
+func (e Events) AddDays(days int) *Events {
+	return e.mapTimes(func(t time.Time) time.Time { return t.AddDate(0, 0, days) })
+}
+
+//mapTimes applies f to every event time that isn't zero
+func (e Events) mapTimes(f func(t time.Time) time.Time) *Events {
+	at := func(t time.Time) time.Time {
+		if t.IsZero() {
+			return t
+		}
+		return f(t)
+	}
+	window := func(w Window) Window {
+		return Window{Start: at(w.Start), End: at(w.End)}
+	}
+	return &Events{
+		AstronomicalDawn:  at(e.AstronomicalDawn),
+		NauticalDawn:      at(e.NauticalDawn),
+		Dawn:              at(e.Dawn),
+		SunRise:           at(e.SunRise),
+		SunPeak:           at(e.SunPeak),
+		SunSet:            at(e.SunSet),
+		Dusk:              at(e.Dusk),
+		NauticalDusk:      at(e.NauticalDusk),
+		AstronomicalDusk:  at(e.AstronomicalDusk),
+		MorningBlueHour:   window(e.MorningBlueHour),
+		EveningBlueHour:   window(e.EveningBlueHour),
+		MorningGoldenHour: window(e.MorningGoldenHour),
+		EveningGoldenHour: window(e.EveningGoldenHour),
+		DayLength:         e.DayLength,
+	}
+}
+
 type apiEvents struct {
 	Sunrise                   time.Time `json:"sunrise"`
 	Sunset                    time.Time `json:"sunset"`
@@ -83,9 +147,29 @@ var statusMap = map[string]string{
 	"UNKNOWN_ERROR":   "the request could not be processed due to a server error. the request may succeed if you try again",
 }
 
-//GetEvents returns astronomical event times
+//GetEvents returns astronomical event times for the current day, as the api sees it
 func (api *API) GetEvents() (*Events, error) {
-	path := fmt.Sprintf("/json?lat=%f&lng=%f&formatted=0", myLatitude, myLongitude)
+	return api.getEvents(api.query())
+}
+
+//GetEventsFor returns astronomical event times for the calendar day of date
+func (api *API) GetEventsFor(date time.Time) (*Events, error) {
+	if api.Location != nil {
+		date = date.In(api.Location)
+	}
+	return api.getEvents(fmt.Sprintf("%s&date=%s", api.query(), date.Format(dayFormat)))
+}
+
+func (api *API) query() string {
+	query := fmt.Sprintf("lat=%f&lng=%f&formatted=0", api.Latitude, api.Longitude)
+	if api.Location != nil {
+		query = fmt.Sprintf("%s&tzid=%s", query, url.QueryEscape(api.Location.String()))
+	}
+	return query
+}
+
+func (api *API) getEvents(query string) (*Events, error) {
+	path := fmt.Sprintf("/json?%s", query)
 	resp, err := api.Client.Get(fmt.Sprintf("%s%s", api.URL, path))
 	if err != nil {
 		return nil, fmt.Errorf("Error making api request: %s", err)
@@ -118,11 +202,31 @@ func (api *API) GetEvents() (*Events, error) {
 		return nil, errors.New("Results json was empty")
 	}
 
-	return &Events{
-		Dawn:    results.CivilTwilightBegin,
-		SunRise: results.Sunrise,
-		SunPeak: results.SolarNoon,
-		SunSet:  results.Sunset,
-		Dusk:    results.CivilTwilightEnd,
-	}, nil
+	//the api doesn't know about golden and blue hours, so they are calculated locally
+	calculator := NewCalculator(func(c *Calculator) {
+		c.Latitude = api.Latitude
+		c.Longitude = api.Longitude
+	})
+	hours := calculator.hours(results.SolarNoon)
+
+	events := &Events{
+		AstronomicalDawn:  results.AstronomicalTwilightBegin,
+		NauticalDawn:      results.NauticalTwilightBegin,
+		Dawn:              results.CivilTwilightBegin,
+		SunRise:           results.Sunrise,
+		SunPeak:           results.SolarNoon,
+		SunSet:            results.Sunset,
+		Dusk:              results.CivilTwilightEnd,
+		NauticalDusk:      results.NauticalTwilightEnd,
+		AstronomicalDusk:  results.AstronomicalTwilightEnd,
+		MorningBlueHour:   hours.MorningBlueHour,
+		EveningBlueHour:   hours.EveningBlueHour,
+		MorningGoldenHour: hours.MorningGoldenHour,
+		EveningGoldenHour: hours.EveningGoldenHour,
+		DayLength:         time.Duration(results.DayLength) * time.Second,
+	}
+	if api.Location != nil {
+		events = events.In(api.Location)
+	}
+	return events, nil
 }
@@ -69,13 +69,30 @@ var _ = Describe("GetEvents", func() {
 				events, err := client.GetEvents()
 				Expect(server.ReceivedRequests()).To(HaveLen(1))
 				Expect(err).NotTo(HaveOccurred())
-				Expect(events).To(Equal(&Events{
-					Dawn:    parseTimeHelper("2015-05-21T04:36:17+00:00"),
-					SunRise: parseTimeHelper("2015-05-21T05:05:35+00:00"),
-					SunPeak: parseTimeHelper("2015-05-21T12:14:17+00:00"),
-					SunSet:  parseTimeHelper("2015-05-21T19:22:59+00:00"),
-					Dusk:    parseTimeHelper("2015-05-21T19:52:17+00:00"),
-				}))
+				Expect(events.Dawn).To(Equal(parseTimeHelper("2015-05-21T04:36:17+00:00")))
+				Expect(events.SunRise).To(Equal(parseTimeHelper("2015-05-21T05:05:35+00:00")))
+				Expect(events.SunPeak).To(Equal(parseTimeHelper("2015-05-21T12:14:17+00:00")))
+				Expect(events.SunSet).To(Equal(parseTimeHelper("2015-05-21T19:22:59+00:00")))
+				Expect(events.Dusk).To(Equal(parseTimeHelper("2015-05-21T19:52:17+00:00")))
+			})
+
+			It("should return the nautical and astronomical twilight and day length", func() {
+				events, err := client.GetEvents()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(events.AstronomicalDawn).To(Equal(parseTimeHelper("2015-05-21T03:20:49+00:00")))
+				Expect(events.NauticalDawn).To(Equal(parseTimeHelper("2015-05-21T04:00:13+00:00")))
+				Expect(events.NauticalDusk).To(Equal(parseTimeHelper("2015-05-21T20:28:21+00:00")))
+				Expect(events.AstronomicalDusk).To(Equal(parseTimeHelper("2015-05-21T21:07:45+00:00")))
+				Expect(events.DayLength).To(Equal(51444 * time.Second))
+			})
+
+			It("should calculate the blue and golden hours", func() {
+				events, err := client.GetEvents()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(events.MorningBlueHour.Start.Before(events.MorningBlueHour.End)).To(BeTrue())
+				Expect(events.MorningGoldenHour.Start).To(Equal(events.MorningBlueHour.End))
+				Expect(events.EveningGoldenHour.End).To(Equal(events.EveningBlueHour.Start))
+				Expect(events.EveningBlueHour.Start.Before(events.EveningBlueHour.End)).To(BeTrue())
 			})
 		})
 
@@ -167,4 +184,69 @@ var _ = Describe("GetEvents", func() {
 			})
 		})
 	})
+
+	Describe("fetching json for a date", func() {
+		body := `{
+			"results":
+			{
+			  "sunrise":"2019-12-21T07:23:00-06:00",
+			  "sunset":"2019-12-21T17:35:00-06:00",
+			  "solar_noon":"2019-12-21T12:29:00-06:00",
+			  "day_length":36720,
+			  "civil_twilight_begin":"2019-12-21T06:57:00-06:00",
+			  "civil_twilight_end":"2019-12-21T18:01:00-06:00",
+			  "nautical_twilight_begin":"2019-12-21T06:27:00-06:00",
+			  "nautical_twilight_end":"2019-12-21T18:31:00-06:00",
+			  "astronomical_twilight_begin":"2019-12-21T05:57:00-06:00",
+			  "astronomical_twilight_end":"2019-12-21T19:01:00-06:00"
+			},
+			 "status":"OK"
+		  }`
+
+		Context("with a custom location", func() {
+			BeforeEach(func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/json", "lat=36.720160&lng=-4.420340&formatted=0&date=2015-05-21"),
+						ghttp.RespondWith(http.StatusOK, body),
+					),
+				)
+				client.SetOptions(func(api *API) {
+					api.Latitude = 36.72016
+					api.Longitude = -4.42034
+				})
+			})
+
+			It("should send the coordinates and date", func() {
+				_, err := client.GetEventsFor(parseTimeHelper("2015-05-21T12:00:00+00:00"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(server.ReceivedRequests()).To(HaveLen(1))
+			})
+		})
+
+		Context("with a time zone", func() {
+			var chicago *time.Location
+
+			BeforeEach(func() {
+				chicago, _ = time.LoadLocation("America/Chicago")
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/json", "lat=30.262890&lng=-97.720119&formatted=0&tzid=America%2FChicago&date=2019-12-21"),
+						ghttp.RespondWith(http.StatusOK, body),
+					),
+				)
+				client.SetOptions(func(api *API) {
+					api.Location = chicago
+				})
+			})
+
+			It("should use the local date and return local times", func() {
+				//still the 21st in Chicago
+				events, err := client.GetEventsFor(parseTimeHelper("2019-12-22T03:00:00+00:00"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(events.SunRise.Location()).To(Equal(chicago))
+				Expect(events.SunRise.Equal(parseTimeHelper("2019-12-21T07:23:00-06:00"))).To(BeTrue())
+			})
+		})
+	})
 })
@@ -0,0 +1,219 @@
+package astronomy
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/rltvty/go-home/dmx/clock"
+	"github.com/rltvty/go-home/logwrapper"
+	"go.uber.org/zap"
+)
+
+const dayFormat = "2006-01-02"
+const defaultRetryInterval = 15 * time.Minute
+
+//Source returns the events on the calendar day of date
+type Source func(date time.Time) (*Events, error)
+
+//Day is a calendar day, starting at Date, along with its events
+type Day struct {
+	Date   time.Time
+	Events Events
+}
+
+//DaysAround gets the events of yesterday, today and tomorrow in the location of now.  Events are absolute times,
+//so a cue on an event that falls after midnight, like dusk in a high latitude summer, lands on the right day.
+func DaysAround(now time.Time, source Source) ([]Day, error) {
+	days := make([]Day, 0, 3)
+	for offset := -1; offset <= 1; offset++ {
+		date := time.Date(now.Year(), now.Month(), now.Day()+offset, 0, 0, 0, 0, now.Location())
+		events, err := source(date)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, Day{Date: date, Events: *events})
+	}
+	return days, nil
+}
+
+//Provider hands out the events for each day, getting them once per day.
+//When every source fails it moves the last events it got onto the day asked for, retrying every RetryInterval.
+type Provider struct {
+	Sources       []Source
+	RetryInterval time.Duration
+	//Clock says what today is for Today
+	Clock clock.Clock
+	//Fallback, if set, answers straight away for a day that isn't cached yet, while the sources are tried in the
+	//background.  It should be quick, like a Calculator, so slow sources never hold up rendering.
+	Fallback Source
+
+	mu          sync.Mutex
+	days        map[string]*Events
+	attempts    map[string]time.Time
+	lastGood    *Events
+	lastGoodDay string
+	fetching    map[string]bool
+	interim     map[string]*Events
+}
+
+//NewProvider creates a provider that tries each source in order, with optional options
+func NewProvider(sources []Source, options ...func(*Provider)) *Provider {
+	provider := Provider{
+		Sources:       sources,
+		RetryInterval: defaultRetryInterval,
+		Clock:         clock.Real{},
+		days:          map[string]*Events{},
+		attempts:      map[string]time.Time{},
+		fetching:      map[string]bool{},
+		interim:       map[string]*Events{},
+	}
+	provider.SetOptions(options...)
+
+	return &provider
+}
+
+// SetOptions takes one or more option function and applies them in order to Provider.
+func (p *Provider) SetOptions(options ...func(*Provider)) {
+	for _, opt := range options {
+		opt(p)
+	}
+}
+
+//EventsFor returns the events for the day of now, or the last known good events if they can't be refreshed
+func (p *Provider) EventsFor(now time.Time) (*Events, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.eventsFor(now, now)
+}
+
+//Days returns the events of yesterday, today and tomorrow, as in DaysAround
+func (p *Provider) Days(now time.Time) ([]Day, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return DaysAround(now, func(date time.Time) (*Events, error) {
+		return p.eventsFor(date, now)
+	})
+}
+
+//Today returns the events of yesterday, today and tomorrow on the provider's clock
+func (p *Provider) Today() ([]Day, error) {
+	return p.Days(p.Clock.Now())
+}
+
+func (p *Provider) eventsFor(date time.Time, now time.Time) (*Events, error) {
+	day := date.Format(dayFormat)
+	if events, ok := p.days[day]; ok {
+		return events, nil
+	}
+	if p.Fallback != nil {
+		return p.eventsInBackground(date, day, now)
+	}
+	if p.lastGood != nil && now.Sub(p.attempts[day]) < p.RetryInterval {
+		return p.stale(day), nil
+	}
+
+	p.attempts[day] = now
+	if events, err := p.fetch(date); err == nil {
+		p.store(day, events, now)
+		return events, nil
+	}
+
+	if p.lastGood == nil {
+		return nil, errors.New("No astronomical events available")
+	}
+	logwrapper.GetInstance().Info("Using astronomical events from an earlier day", zap.String("day", p.lastGoodDay))
+	return p.stale(day), nil
+}
+
+//eventsInBackground starts getting a day's events from the sources without holding the lock, answering from the
+//fallback until they arrive
+func (p *Provider) eventsInBackground(date time.Time, day string, now time.Time) (*Events, error) {
+	if !p.fetching[day] && now.Sub(p.attempts[day]) >= p.RetryInterval {
+		p.fetching[day] = true
+		p.attempts[day] = now
+		go func() {
+			events, err := p.fetch(date)
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			delete(p.fetching, day)
+			if err == nil {
+				p.store(day, events, now)
+				delete(p.interim, day)
+			}
+		}()
+	}
+
+	if events, ok := p.interim[day]; ok {
+		return events, nil
+	}
+	events, err := p.Fallback(date)
+	if err != nil {
+		if p.lastGood == nil {
+			return nil, errors.New("No astronomical events available")
+		}
+		return p.stale(day), nil
+	}
+	p.interim[day] = events
+	return events, nil
+}
+
+//fetch tries each source in turn for the events of date
+func (p *Provider) fetch(date time.Time) (*Events, error) {
+	log := logwrapper.GetInstance()
+	for _, source := range p.Sources {
+		events, err := source(date)
+		if err != nil {
+			log.InfoError("Unable to get astronomical events", err)
+			continue
+		}
+		log.Info("Got astronomical events", zap.String("day", date.Format(dayFormat)), zap.String("events", events.String()))
+		return events, nil
+	}
+	return nil, errors.New("No astronomical events available")
+}
+
+//store caches the events got for day
+func (p *Provider) store(day string, events *Events, now time.Time) {
+	p.days[day] = events
+	if day >= p.lastGoodDay {
+		p.lastGood = events
+		p.lastGoodDay = day
+	}
+	p.prune(now)
+}
+
+//stale moves the last known good events onto day
+func (p *Provider) stale(day string) *Events {
+	from, _ := time.Parse(dayFormat, p.lastGoodDay)
+	to, _ := time.Parse(dayFormat, day)
+	return p.lastGood.AddDays(int(math.Round(to.Sub(from).Hours() / 24)))
+}
+
+//prune forgets days more than a couple of days before now
+func (p *Provider) prune(now time.Time) {
+	oldest := now.AddDate(0, 0, -2).Format(dayFormat)
+	for day := range p.days {
+		if day < oldest {
+			delete(p.days, day)
+		}
+	}
+	for day := range p.attempts {
+		if day < oldest {
+			delete(p.attempts, day)
+		}
+	}
+	for day := range p.interim {
+		if day < oldest {
+			delete(p.interim, day)
+		}
+	}
+}
+
+//CachedDay is the latest day the provider got events for
+func (p *Provider) CachedDay() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lastGoodDay
+}
@@ -0,0 +1,143 @@
+package astronomy_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/rltvty/go-home/dmx/astronomy"
+	"github.com/rltvty/go-home/dmx/clock"
+)
+
+var _ = Describe("Provider", func() {
+	now := parseTimeHelper("2019-06-01T12:00:00+00:00")
+	var calls int
+	var failing bool
+	var provider *Provider
+
+	source := func(date time.Time) (*Events, error) {
+		calls++
+		if failing {
+			return nil, errors.New("offline")
+		}
+		return &Events{SunPeak: date}, nil
+	}
+
+	BeforeEach(func() {
+		calls = 0
+		failing = false
+		provider = NewProvider([]Source{source}, func(p *Provider) {
+			p.RetryInterval = time.Hour
+		})
+	})
+
+	It("should only get events once per day", func() {
+		events, err := provider.EventsFor(now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events.SunPeak).To(Equal(now))
+		provider.EventsFor(now.Add(11 * time.Hour))
+		Expect(calls).To(Equal(1))
+		Expect(provider.CachedDay()).To(Equal("2019-06-01"))
+	})
+
+	It("should refresh on a new day", func() {
+		provider.EventsFor(now)
+		events, _ := provider.EventsFor(now.Add(13 * time.Hour))
+		Expect(calls).To(Equal(2))
+		Expect(events.SunPeak).To(Equal(now.Add(13 * time.Hour)))
+		Expect(provider.CachedDay()).To(Equal("2019-06-02"))
+	})
+
+	It("should fall back to the cache moved onto the day when refreshing fails, and retry later", func() {
+		provider.EventsFor(now)
+		failing = true
+		events, err := provider.EventsFor(now.Add(24 * time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events.SunPeak).To(Equal(now.Add(24 * time.Hour)))
+		Expect(provider.CachedDay()).To(Equal("2019-06-01"))
+		provider.EventsFor(now.Add(24*time.Hour + 30*time.Minute))
+		Expect(calls).To(Equal(2))
+		provider.EventsFor(now.Add(25 * time.Hour))
+		Expect(calls).To(Equal(3))
+	})
+
+	It("should try the next source when one fails", func() {
+		provider = NewProvider([]Source{
+			func(time.Time) (*Events, error) { return nil, errors.New("offline") },
+			source,
+		})
+		events, err := provider.EventsFor(now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events.SunPeak).To(Equal(now))
+	})
+
+	It("should keep the wall clock times when moving the cache over a DST change", func() {
+		chicago, _ := time.LoadLocation("America/Chicago")
+		saturday := time.Date(2019, 3, 9, 12, 0, 0, 0, chicago)
+		provider.EventsFor(saturday)
+		failing = true
+		events, _ := provider.EventsFor(saturday.AddDate(0, 0, 1))
+		Expect(events.SunPeak).To(Equal(time.Date(2019, 3, 10, 12, 0, 0, 0, chicago)))
+	})
+
+	It("should get the days around now", func() {
+		days, err := provider.Days(now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(days).To(HaveLen(3))
+		for i, day := range days {
+			Expect(day.Date).To(Equal(time.Date(2019, 5, 31+i, 0, 0, 0, 0, now.Location())))
+			Expect(day.Events.SunPeak).To(Equal(day.Date))
+		}
+		provider.Days(now.Add(time.Hour))
+		Expect(calls).To(Equal(3))
+		provider.Days(now.Add(24 * time.Hour))
+		Expect(calls).To(Equal(4))
+	})
+
+	It("should get the days around its clock's today", func() {
+		provider.SetOptions(func(p *Provider) {
+			p.Clock = clock.NewFixed(now)
+		})
+		days, err := provider.Today()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(days[1].Date).To(Equal(time.Date(2019, 6, 1, 0, 0, 0, 0, now.Location())))
+	})
+
+	Context("with a fallback", func() {
+		var release chan int
+
+		BeforeEach(func() {
+			release = make(chan int)
+			slow := func(date time.Time) (*Events, error) {
+				<-release
+				return &Events{SunPeak: date.Add(12 * time.Hour)}, nil
+			}
+			provider = NewProvider([]Source{slow}, func(p *Provider) {
+				p.RetryInterval = time.Hour
+				p.Fallback = source
+			})
+		})
+
+		It("should answer from the fallback while the sources are tried in the background", func() {
+			events, err := provider.EventsFor(now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events.SunPeak).To(Equal(now))
+			provider.EventsFor(now)
+			Expect(calls).To(Equal(1))
+			Expect(provider.CachedDay()).To(BeEmpty())
+
+			close(release)
+			Eventually(provider.CachedDay).Should(Equal("2019-06-01"))
+			events, _ = provider.EventsFor(now)
+			Expect(events.SunPeak).To(Equal(now.Add(12 * time.Hour)))
+		})
+	})
+
+	It("should error when nothing has ever been available", func() {
+		failing = true
+		_, err := provider.EventsFor(now)
+		Expect(err).To(MatchError("No astronomical events available"))
+	})
+})
@@ -0,0 +1,188 @@
+package astronomy
+
+import (
+	"math"
+	"time"
+
+	"github.com/rltvty/go-home/dmx/clock"
+)
+
+//zenith angles, in degrees, of the sun at each event.  Sunrise and sunset allow for refraction and the sun's radius
+const (
+	goldenHourZenith   = 84.0
+	sunriseZenith      = 90.833
+	blueHourZenith     = 94.0
+	civilZenith        = 96.0
+	nauticalZenith     = 102.0
+	astronomicalZenith = 108.0
+)
+
+//Calculator computes astronomical events locally, using the NOAA solar position algorithm
+type Calculator struct {
+	Latitude  float64
+	Longitude float64
+	//Location is the time zone dates are interpreted in and events are returned in, nil uses the location of each date
+	Location *time.Location
+	//Clock says what today is for GetEvents
+	Clock clock.Clock
+}
+
+//NewCalculator creates the calculator with optional options
+func NewCalculator(options ...func(*Calculator)) *Calculator {
+	calculator := Calculator{
+		Latitude:  myLatitude,
+		Longitude: myLongitude,
+		Clock:     clock.Real{},
+	}
+	calculator.SetOptions(options...)
+
+	return &calculator
+}
+
+// SetOptions takes one or more option function and applies them in order to Calculator.
+func (c *Calculator) SetOptions(options ...func(*Calculator)) {
+	for _, opt := range options {
+		opt(c)
+	}
+}
+
+//GetEvents returns today's astronomical event times
+func (c *Calculator) GetEvents() (*Events, error) {
+	return c.GetEventsFor(c.Clock.Now())
+}
+
+//GetEventsFor returns the astronomical event times on the calendar day of date, in the calculator's location or else date's.
+//Events that don't happen that day, like dusk during polar day, are left as the zero time.
+func (c *Calculator) GetEventsFor(date time.Time) (*Events, error) {
+	if c.Location != nil {
+		date = date.In(c.Location)
+	}
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	at := func(zenith float64, direction float64) time.Time {
+		return c.event(day, zenith, direction)
+	}
+	hours := c.hours(day)
+
+	events := &Events{
+		AstronomicalDawn:  at(astronomicalZenith, -1),
+		NauticalDawn:      at(nauticalZenith, -1),
+		Dawn:              at(civilZenith, -1),
+		SunRise:           at(sunriseZenith, -1),
+		SunPeak:           at(0, 0),
+		SunSet:            at(sunriseZenith, 1),
+		Dusk:              at(civilZenith, 1),
+		NauticalDusk:      at(nauticalZenith, 1),
+		AstronomicalDusk:  at(astronomicalZenith, 1),
+		MorningBlueHour:   hours.MorningBlueHour,
+		EveningBlueHour:   hours.EveningBlueHour,
+		MorningGoldenHour: hours.MorningGoldenHour,
+		EveningGoldenHour: hours.EveningGoldenHour,
+	}
+	events.DayLength = dayLength(c.Latitude, day, events)
+
+	return events.In(date.Location()), nil
+}
+
+//hours calculates the golden and blue hour windows on the UTC calendar day of date
+func (c *Calculator) hours(date time.Time) Events {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	window := func(from float64, to float64, direction float64) Window {
+		return Window{Start: c.event(day, from, direction), End: c.event(day, to, direction)}
+	}
+	return Events{
+		MorningBlueHour:   window(civilZenith, blueHourZenith, -1),
+		EveningBlueHour:   window(blueHourZenith, civilZenith, 1),
+		MorningGoldenHour: window(blueHourZenith, goldenHourZenith, -1),
+		EveningGoldenHour: window(goldenHourZenith, blueHourZenith, 1),
+	}
+}
+
+//dayLength is how long the sun is up, which is all day or none of it when it doesn't rise or set
+func dayLength(latitude float64, day time.Time, events *Events) time.Duration {
+	if !events.SunRise.IsZero() && !events.SunSet.IsZero() {
+		return events.SunSet.Sub(events.SunRise)
+	}
+	//with no sunrise, the sun is up all day if it is above the horizon at noon
+	if 90-math.Abs(latitude-degrees(sunPosition(events.SunPeak).declination)) > 0 {
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+//event finds when the sun reaches zenith before (direction -1) or after (direction 1) solar noon on day.
+//A direction of 0 finds solar noon itself.  Each pass recomputes the sun's position at the previous estimate.
+func (c *Calculator) event(day time.Time, zenith float64, direction float64) time.Time {
+	t := day.Add(minutes(720 - 4*c.Longitude))
+	for i := 0; i < 3; i++ {
+		position := sunPosition(t)
+		offset := 0.0
+		if direction != 0 {
+			angle, ok := hourAngle(c.Latitude, position.declination, zenith)
+			if !ok {
+				return time.Time{}
+			}
+			offset = direction * 4 * angle
+		}
+		t = day.Add(minutes(720 - 4*c.Longitude - position.equationOfTime + offset))
+	}
+	return t.Round(time.Second)
+}
+
+func minutes(m float64) time.Duration {
+	return time.Duration(m * float64(time.Minute))
+}
+
+func hourAngle(latitude float64, declination float64, zenith float64) (float64, bool) {
+	lat := radians(latitude)
+	cosHourAngle := math.Cos(radians(zenith))/(math.Cos(lat)*math.Cos(declination)) - math.Tan(lat)*math.Tan(declination)
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return 0, false
+	}
+	return degrees(math.Acos(cosHourAngle)), true
+}
+
+type position struct {
+	//declination of the sun, in radians
+	declination float64
+	//equationOfTime is the difference between apparent and mean solar time, in minutes
+	equationOfTime float64
+}
+
+func sunPosition(t time.Time) position {
+	julianDay := float64(t.Unix())/86400 + 2440587.5
+	century := (julianDay - 2451545) / 36525
+
+	meanLongitude := math.Mod(280.46646+century*(36000.76983+century*0.0003032), 360)
+	meanAnomaly := 357.52911 + century*(35999.05029-0.0001537*century)
+	eccentricity := 0.016708634 - century*(0.000042037+0.0000001267*century)
+
+	m := radians(meanAnomaly)
+	center := math.Sin(m)*(1.914602-century*(0.004817+0.000014*century)) +
+		math.Sin(2*m)*(0.019993-0.000101*century) +
+		math.Sin(3*m)*0.000289
+	trueLongitude := meanLongitude + center
+	omega := radians(125.04 - 1934.136*century)
+	apparentLongitude := trueLongitude - 0.00569 - 0.00478*math.Sin(omega)
+
+	meanObliquity := 23 + (26+(21.448-century*(46.815+century*(0.00059-century*0.001813)))/60)/60
+	obliquity := radians(meanObliquity + 0.00256*math.Cos(omega))
+	declination := math.Asin(math.Sin(obliquity) * math.Sin(radians(apparentLongitude)))
+
+	y := math.Pow(math.Tan(obliquity/2), 2)
+	l0 := radians(meanLongitude)
+	equationOfTime := 4 * degrees(y*math.Sin(2*l0)-
+		2*eccentricity*math.Sin(m)+
+		4*eccentricity*y*math.Sin(m)*math.Cos(2*l0)-
+		0.5*y*y*math.Sin(4*l0)-
+		1.25*eccentricity*eccentricity*math.Sin(2*m))
+
+	return position{declination: declination, equationOfTime: equationOfTime}
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
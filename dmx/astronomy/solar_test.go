@@ -0,0 +1,99 @@
+package astronomy_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/rltvty/go-home/dmx/astronomy"
+)
+
+func expectWithinAMinute(actual time.Time, expected string) {
+	ExpectWithOffset(1, actual.Sub(parseTimeHelper(expected))).To(BeNumerically("~", 0, time.Minute))
+}
+
+var _ = Describe("Calculator", func() {
+	Context("at the sunrise-sunset.org documentation example", func() {
+		It("should agree with the api to within a minute", func() {
+			calculator := NewCalculator(func(c *Calculator) {
+				c.Latitude = 36.7201600
+				c.Longitude = -4.4203400
+			})
+			events, err := calculator.GetEventsFor(parseTimeHelper("2015-05-21T12:00:00+00:00"))
+			Expect(err).NotTo(HaveOccurred())
+			expectWithinAMinute(events.Dawn, "2015-05-21T04:36:17+00:00")
+			expectWithinAMinute(events.SunRise, "2015-05-21T05:05:35+00:00")
+			expectWithinAMinute(events.SunPeak, "2015-05-21T12:14:17+00:00")
+			expectWithinAMinute(events.SunSet, "2015-05-21T19:22:59+00:00")
+			expectWithinAMinute(events.Dusk, "2015-05-21T19:52:17+00:00")
+			expectWithinAMinute(events.AstronomicalDawn, "2015-05-21T03:20:49+00:00")
+			expectWithinAMinute(events.NauticalDawn, "2015-05-21T04:00:13+00:00")
+			expectWithinAMinute(events.NauticalDusk, "2015-05-21T20:28:21+00:00")
+			expectWithinAMinute(events.AstronomicalDusk, "2015-05-21T21:07:45+00:00")
+			Expect(events.DayLength).To(BeNumerically("~", 51444*time.Second, time.Minute))
+		})
+	})
+
+	Context("in Austin", func() {
+		//times from the NOAA solar calculator
+		It("should match the summer solstice", func() {
+			events, _ := NewCalculator().GetEventsFor(parseTimeHelper("2019-06-21T12:00:00-05:00"))
+			expectWithinAMinute(events.SunRise, "2019-06-21T06:29:00-05:00")
+			expectWithinAMinute(events.SunPeak, "2019-06-21T13:32:40-05:00")
+			expectWithinAMinute(events.SunSet, "2019-06-21T20:36:00-05:00")
+		})
+
+		It("should place the blue hour between civil dawn and the golden hour", func() {
+			events, _ := NewCalculator().GetEventsFor(parseTimeHelper("2019-06-21T12:00:00-05:00"))
+			Expect(events.MorningBlueHour.Start).To(Equal(events.Dawn))
+			Expect(events.MorningBlueHour.End).To(Equal(events.MorningGoldenHour.Start))
+			Expect(events.MorningGoldenHour.End.After(events.SunRise)).To(BeTrue())
+			Expect(events.EveningGoldenHour.Start.Before(events.SunSet)).To(BeTrue())
+			Expect(events.EveningGoldenHour.End).To(Equal(events.EveningBlueHour.Start))
+			Expect(events.EveningBlueHour.End).To(Equal(events.Dusk))
+		})
+
+		It("should match the winter solstice", func() {
+			events, _ := NewCalculator().GetEventsFor(parseTimeHelper("2019-12-21T12:00:00-06:00"))
+			expectWithinAMinute(events.SunRise, "2019-12-21T07:23:00-06:00")
+			expectWithinAMinute(events.SunPeak, "2019-12-21T12:29:00-06:00")
+			expectWithinAMinute(events.SunSet, "2019-12-21T17:35:00-06:00")
+		})
+
+		It("should return times in the location of the date", func() {
+			events, _ := NewCalculator().GetEventsFor(parseTimeHelper("2019-12-21T12:00:00-06:00"))
+			Expect(events.SunRise.Format("-07:00")).To(Equal("-06:00"))
+		})
+	})
+
+	Context("with a location", func() {
+		It("should use the calendar day and time zone of the location", func() {
+			tokyo, _ := time.LoadLocation("Asia/Tokyo")
+			calculator := NewCalculator(func(c *Calculator) {
+				c.Latitude = 35.6762
+				c.Longitude = 139.6503
+				c.Location = tokyo
+			})
+			//already the 22nd in Tokyo
+			events, _ := calculator.GetEventsFor(parseTimeHelper("2019-06-21T20:00:00+00:00"))
+			Expect(events.SunPeak.Location()).To(Equal(tokyo))
+			expectWithinAMinute(events.SunPeak, "2019-06-22T11:43:00+09:00")
+		})
+	})
+
+	Context("during polar day", func() {
+		It("should leave events that don't happen as zero", func() {
+			calculator := NewCalculator(func(c *Calculator) {
+				c.Latitude = 70
+				c.Longitude = 20
+			})
+			events, err := calculator.GetEventsFor(parseTimeHelper("2019-06-21T12:00:00+00:00"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events.SunRise.IsZero()).To(BeTrue())
+			Expect(events.Dusk.IsZero()).To(BeTrue())
+			Expect(events.DayLength).To(Equal(24 * time.Hour))
+			expectWithinAMinute(events.SunPeak, "2019-06-21T10:41:44+00:00")
+		})
+	})
+})
@@ -0,0 +1,203 @@
+package calendar
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const dateFormat = "2006-01-02"
+
+var dayNames = map[string][]time.Weekday{
+	"sun":     {time.Sunday},
+	"mon":     {time.Monday},
+	"tue":     {time.Tuesday},
+	"wed":     {time.Wednesday},
+	"thu":     {time.Thursday},
+	"fri":     {time.Friday},
+	"sat":     {time.Saturday},
+	"weekday": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekend": {time.Saturday, time.Sunday},
+}
+
+//ParseDays parses a day name (mon ... sun), "weekday" or "weekend"
+func ParseDays(name string) ([]time.Weekday, error) {
+	days, ok := dayNames[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown day: %s", name)
+	}
+	return days, nil
+}
+
+//RuleJSON intermediate type for parsing a rule.  Every condition that is set must match for the rule to apply.
+type RuleJSON struct {
+	Program string   `json:"program"`
+	Days    []string `json:"days"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	//Calendar is an ICS file, the rule matches days with an event whose summary contains Summary
+	Calendar string `json:"calendar"`
+	Summary  string `json:"summary"`
+	//Mode matches when the manual mode set over the API is this value, e.g. "away"
+	Mode string `json:"mode"`
+}
+
+//ScheduleJSON intermediate type for parsing a schedule
+type ScheduleJSON struct {
+	//Programs maps program names to program files, relative to the schedule file
+	Programs map[string]string `json:"programs"`
+	Rules    []RuleJSON        `json:"rules"`
+	Default  string            `json:"default"`
+}
+
+//Rule picks a program for the days it matches
+type Rule struct {
+	Program string
+	days    map[time.Weekday]bool
+	from    time.Time
+	to      time.Time
+	events  []Event
+	summary string
+	mode    string
+}
+
+//Schedule picks which program runs on a given day
+type Schedule struct {
+	//Programs maps program names to program file paths, an empty path is the built in default loop
+	Programs map[string]string
+	Rules    []Rule
+	Default  string
+}
+
+//ParseJSON parses a schedule, with calendar and program paths relative to dir
+func ParseJSON(jsonData []byte, dir string) (*Schedule, error) {
+	var definition ScheduleJSON
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&definition); err != nil {
+		return nil, err
+	}
+
+	schedule := Schedule{Programs: map[string]string{}, Default: definition.Default}
+	for name, path := range definition.Programs {
+		if path != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		schedule.Programs[name] = path
+	}
+	if _, ok := schedule.Programs[schedule.Default]; !ok {
+		return nil, fmt.Errorf("Unknown default program: %s", schedule.Default)
+	}
+
+	for i, ruleJSON := range definition.Rules {
+		rule, err := parseRule(ruleJSON, dir)
+		if err != nil {
+			return nil, fmt.Errorf("Rule %d: %s", i, err)
+		}
+		if _, ok := schedule.Programs[rule.Program]; !ok {
+			return nil, fmt.Errorf("Rule %d: unknown program: %s", i, rule.Program)
+		}
+		schedule.Rules = append(schedule.Rules, *rule)
+	}
+	return &schedule, nil
+}
+
+//Load reads and parses a schedule file
+func Load(path string) (*Schedule, error) {
+	jsonData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJSON(jsonData, filepath.Dir(path))
+}
+
+func parseRule(ruleJSON RuleJSON, dir string) (*Rule, error) {
+	rule := Rule{Program: ruleJSON.Program, summary: ruleJSON.Summary, mode: ruleJSON.Mode}
+
+	if len(ruleJSON.Days) > 0 {
+		rule.days = map[time.Weekday]bool{}
+		for _, name := range ruleJSON.Days {
+			days, err := ParseDays(name)
+			if err != nil {
+				return nil, err
+			}
+			for _, day := range days {
+				rule.days[day] = true
+			}
+		}
+	}
+
+	var err error
+	if ruleJSON.From != "" {
+		if rule.from, err = time.ParseInLocation(dateFormat, ruleJSON.From, time.Local); err != nil {
+			return nil, fmt.Errorf("invalid from date: %s", ruleJSON.From)
+		}
+	}
+	if ruleJSON.To != "" {
+		if rule.to, err = time.ParseInLocation(dateFormat, ruleJSON.To, time.Local); err != nil {
+			return nil, fmt.Errorf("invalid to date: %s", ruleJSON.To)
+		}
+	}
+
+	if ruleJSON.Calendar != "" {
+		path := ruleJSON.Calendar
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		if rule.events, err = ParseICS(file, time.Local); err != nil {
+			return nil, err
+		}
+	}
+	return &rule, nil
+}
+
+//Matches reports whether the rule applies on the day of date, with the manual mode
+func (r Rule) Matches(date time.Time, mode string) bool {
+	date = date.Local()
+	day := dayStart(date)
+	if r.mode != "" && r.mode != mode {
+		return false
+	}
+	if r.days != nil && !r.days[date.Weekday()] {
+		return false
+	}
+	if !r.from.IsZero() && day.Before(r.from) {
+		return false
+	}
+	if !r.to.IsZero() && day.After(r.to) {
+		return false
+	}
+	if r.events != nil {
+		found := false
+		for _, event := range r.events {
+			if strings.Contains(event.Summary, r.summary) && event.Covers(date) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+//Select returns the name of the program for the day of date: the first matching rule's, or the default
+func (s *Schedule) Select(date time.Time, mode string) string {
+	for _, rule := range s.Rules {
+		if rule.Matches(date, mode) {
+			return rule.Program
+		}
+	}
+	return s.Default
+}
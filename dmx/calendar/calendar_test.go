@@ -0,0 +1,135 @@
+package calendar_test
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	. "github.com/rltvty/go-home/dmx/calendar"
+)
+
+func day(year int, month time.Month, date int) time.Time {
+	return time.Date(year, month, date, 12, 0, 0, 0, time.Local)
+}
+
+var _ = Describe("Calendar", func() {
+	Describe("ParseICS", func() {
+		It("should read all day, timed and folded events", func() {
+			ics := strings.Join([]string{
+				"BEGIN:VCALENDAR",
+				"BEGIN:VEVENT",
+				"SUMMARY:Long",
+				"  weekend",
+				"DTSTART;VALUE=DATE:20190705",
+				"DTEND;VALUE=DATE:20190708",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:Dinner\\, late",
+				"DTSTART:20190710T020000Z",
+				"DTEND:20190710T040000Z",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"SUMMARY:Birthday",
+				"DTSTART;VALUE=DATE:20190301",
+				"RRULE:FREQ=YEARLY",
+				"END:VEVENT",
+				"END:VCALENDAR",
+			}, "\r\n")
+			events, err := ParseICS(strings.NewReader(ics), time.Local)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(events).To(HaveLen(3))
+
+			Expect(events[0].Summary).To(Equal("Long weekend"))
+			Expect(events[0].Covers(day(2019, 7, 4))).To(BeFalse())
+			Expect(events[0].Covers(day(2019, 7, 5))).To(BeTrue())
+			Expect(events[0].Covers(day(2019, 7, 7))).To(BeTrue())
+			Expect(events[0].Covers(day(2019, 7, 8))).To(BeFalse())
+
+			Expect(events[1].Summary).To(Equal("Dinner, late"))
+			Expect(events[1].Start).To(Equal(time.Date(2019, 7, 10, 2, 0, 0, 0, time.UTC)))
+
+			Expect(events[2].Yearly).To(BeTrue())
+			Expect(events[2].Covers(day(2019, 3, 1))).To(BeTrue())
+			Expect(events[2].Covers(day(2023, 3, 1))).To(BeTrue())
+			Expect(events[2].Covers(day(2023, 3, 2))).To(BeFalse())
+		})
+
+		It("should error on events without a start", func() {
+			_, err := ParseICS(strings.NewReader("BEGIN:VEVENT\nSUMMARY:Nothing\nEND:VEVENT\n"), time.Local)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Schedule", func() {
+		var schedule *Schedule
+
+		BeforeEach(func() {
+			var err error
+			schedule, err = ParseJSON([]byte(`{
+				"programs": {"default": "", "weekend": "weekend.json", "holiday": "/etc/holiday.json", "away": "away.json", "vacation": "vacation.json"},
+				"rules": [
+					{"mode": "away", "program": "away"},
+					{"from": "2019-08-10", "to": "2019-08-20", "program": "vacation"},
+					{"calendar": "holidays.ics", "summary": "Holiday", "program": "holiday"},
+					{"days": ["sat", "Sun"], "program": "weekend"}
+				],
+				"default": "default"
+			}`), "test_data")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should resolve program paths relative to the schedule", func() {
+			Expect(schedule.Programs).To(Equal(map[string]string{
+				"default":  "",
+				"weekend":  "test_data/weekend.json",
+				"holiday":  "/etc/holiday.json",
+				"away":     "test_data/away.json",
+				"vacation": "test_data/vacation.json",
+			}))
+		})
+
+		DescribeTable("Select",
+			func(date time.Time, mode string, expected string) {
+				Expect(schedule.Select(date, mode)).To(Equal(expected))
+			},
+			Entry("a weekday", day(2019, 7, 3), "", "default"),
+			Entry("a saturday", day(2019, 7, 6), "", "weekend"),
+			Entry("a sunday just before midnight", time.Date(2019, 7, 7, 23, 59, 0, 0, time.Local), "", "weekend"),
+			Entry("a monday just after midnight", time.Date(2019, 7, 8, 0, 1, 0, 0, time.Local), "", "default"),
+			Entry("the first day of the date range", day(2019, 8, 10), "", "vacation"),
+			Entry("the last day of the date range", time.Date(2019, 8, 20, 23, 0, 0, 0, time.Local), "", "vacation"),
+			Entry("after the date range", day(2019, 8, 21), "", "default"),
+			Entry("a holiday on a weekday", day(2019, 12, 25), "", "holiday"),
+			Entry("a yearly holiday in a later year", day(2022, 12, 24), "", "holiday"),
+			Entry("a holiday over new year", day(2021, 1, 1), "", "holiday"),
+			Entry("the day after a holiday", day(2019, 12, 27), "", "default"),
+			Entry("away mode over everything", day(2019, 12, 25), "away", "away"),
+			Entry("an unused mode", day(2019, 7, 3), "guests", "default"),
+		)
+
+		It("should reject unknown programs", func() {
+			_, err := ParseJSON([]byte(`{"programs": {"default": ""}, "rules": [{"days": ["mon"], "program": "other"}], "default": "default"}`), "")
+			Expect(err).To(MatchError("Rule 0: unknown program: other"))
+			_, err = ParseJSON([]byte(`{"programs": {"default": ""}, "default": "other"}`), "")
+			Expect(err).To(MatchError("Unknown default program: other"))
+		})
+
+		It("should reject unknown days and bad dates", func() {
+			_, err := ParseJSON([]byte(`{"programs": {"default": ""}, "rules": [{"days": ["someday"], "program": "default"}], "default": "default"}`), "")
+			Expect(err).To(MatchError("Rule 0: unknown day: someday"))
+			_, err = ParseJSON([]byte(`{"programs": {"default": ""}, "rules": [{"from": "2019-13-01", "program": "default"}], "default": "default"}`), "")
+			Expect(err).To(MatchError("Rule 0: invalid from date: 2019-13-01"))
+		})
+
+		It("should load the example schedule", func() {
+			example, err := Load("../programs/schedule.json")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(example.Select(day(2019, 7, 6), "")).To(Equal("weekend"))
+			Expect(example.Select(day(2019, 7, 3), "away")).To(Equal("away"))
+			Expect(example.Select(day(2019, 7, 3), "")).To(Equal("default"))
+		})
+	})
+})
@@ -0,0 +1,142 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+//Event is a calendar entry, covering the days from Start up to but not including End
+type Event struct {
+	Summary string
+	Start   time.Time
+	End     time.Time
+	//Yearly is true for events that repeat every year, like most holidays
+	Yearly bool
+}
+
+//Covers reports whether the event happens on the local calendar day of date
+func (e Event) Covers(date time.Time) bool {
+	day := dayStart(date)
+	start, end := e.Start, e.End
+	if e.Yearly {
+		//move the event to the year of date, and the year before in case it wraps over new year
+		for _, offset := range []int{0, -1} {
+			years := day.Year() - start.Year() + offset
+			if overlaps(day, start.AddDate(years, 0, 0), end.AddDate(years, 0, 0)) {
+				return true
+			}
+		}
+		return false
+	}
+	return overlaps(day, start, end)
+}
+
+func overlaps(day time.Time, start time.Time, end time.Time) bool {
+	return start.Before(day.AddDate(0, 0, 1)) && end.After(day)
+}
+
+func dayStart(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+}
+
+//ParseICS reads the VEVENTs from an iCalendar file.  Only yearly repeats are understood, other repeating events
+//are read as their first occurrence.
+func ParseICS(r io.Reader, loc *time.Location) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []Event{}
+	var current *Event
+	for i, line := range lines {
+		name, params, value := splitProperty(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current = &Event{}
+		case name == "END" && value == "VEVENT":
+			if current == nil || current.Start.IsZero() {
+				return nil, fmt.Errorf("Line %d: event without a start", i+1)
+			}
+			if current.End.IsZero() {
+				//an all day event without an end lasts one day, a timed one is an instant
+				current.End = current.Start
+				if current.Start.Equal(dayStart(current.Start)) {
+					current.End = current.Start.AddDate(0, 0, 1)
+				}
+			}
+			events = append(events, *current)
+			current = nil
+		case current == nil:
+			continue
+		case name == "SUMMARY":
+			current.Summary = unescape(value)
+		case name == "DTSTART" || name == "DTEND":
+			t, err := parseICSTime(value, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: %s", i+1, err)
+			}
+			if name == "DTSTART" {
+				current.Start = t
+			} else {
+				current.End = t
+			}
+		case name == "RRULE":
+			current.Yearly = strings.Contains(value, "FREQ=YEARLY")
+		}
+	}
+	return events, nil
+}
+
+//unfold joins continuation lines, which start with a space or tab
+func unfold(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+//splitProperty splits "DTSTART;VALUE=DATE:20191225" into its name, parameters and value
+func splitProperty(line string) (string, map[string]string, string) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return line, nil, ""
+	}
+	parts := strings.Split(line[:colon], ";")
+	params := map[string]string{}
+	for _, param := range parts[1:] {
+		if eq := strings.Index(param, "="); eq >= 0 {
+			params[strings.ToUpper(param[:eq])] = param[eq+1:]
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+func parseICSTime(value string, params map[string]string, loc *time.Location) (time.Time, error) {
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		return time.ParseInLocation("20060102", value, loc)
+	}
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse("20060102T150405Z", value)
+	}
+	if tzid, ok := params["TZID"]; ok {
+		if tz, err := time.LoadLocation(tzid); err == nil {
+			loc = tz
+		}
+	}
+	return time.ParseInLocation("20060102T150405", value, loc)
+}
+
+func unescape(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
@@ -0,0 +1,94 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+//Clock tells the service what time it is, so everything that runs on the time of day can be run at another time,
+//or faster than real time
+type Clock interface {
+	Now() time.Time
+}
+
+//Real is the system clock, in Location, or the local time zone if it's nil
+type Real struct {
+	Location *time.Location
+}
+
+//Now returns the current time
+func (r Real) Now() time.Time {
+	if r.Location != nil {
+		return time.Now().In(r.Location)
+	}
+	return time.Now()
+}
+
+//Fixed is a clock that stays where it's set, for tests and stepping through simulations
+type Fixed struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+//NewFixed creates a clock stopped at now
+func NewFixed(now time.Time) *Fixed {
+	return &Fixed{now: now}
+}
+
+//Now returns the time the clock is set to
+func (f *Fixed) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+//Set moves the clock to now
+func (f *Fixed) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
+
+//Advance moves the clock on by d
+func (f *Fixed) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+//Accelerated starts at Start and runs Speed times as fast as Source, so a day can be watched in minutes
+type Accelerated struct {
+	Start time.Time
+	Speed float64
+	//Source is the clock that drives this one, the real clock by default
+	Source Clock
+
+	began time.Time
+}
+
+//NewAccelerated creates a clock that reads start now and runs speed times faster than real time, with optional
+//options
+func NewAccelerated(start time.Time, speed float64, options ...func(*Accelerated)) *Accelerated {
+	accelerated := Accelerated{
+		Start:  start,
+		Speed:  speed,
+		Source: Real{},
+	}
+	accelerated.SetOptions(options...)
+	accelerated.began = accelerated.Source.Now()
+
+	return &accelerated
+}
+
+// SetOptions takes one or more option function and applies them in order to Accelerated.
+func (a *Accelerated) SetOptions(options ...func(*Accelerated)) {
+	for _, opt := range options {
+		opt(a)
+	}
+}
+
+//Now returns Start plus Speed times how long Source has run since the clock was created
+func (a *Accelerated) Now() time.Time {
+	elapsed := a.Source.Now().Sub(a.began)
+	return a.Start.Add(time.Duration(float64(elapsed) * a.Speed))
+}
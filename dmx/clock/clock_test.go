@@ -0,0 +1,47 @@
+package clock_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/rltvty/go-home/dmx/clock"
+)
+
+var _ = Describe("Clock", func() {
+	start := time.Date(2019, 6, 21, 6, 0, 0, 0, time.UTC)
+
+	Describe("Real", func() {
+		It("should give the time in its location", func() {
+			tokyo, err := time.LoadLocation("Asia/Tokyo")
+			Expect(err).NotTo(HaveOccurred())
+			now := Real{Location: tokyo}.Now()
+			Expect(now.Location()).To(Equal(tokyo))
+			Expect(now).To(BeTemporally("~", time.Now(), time.Second))
+		})
+	})
+
+	Describe("Fixed", func() {
+		It("should only move when told to", func() {
+			clock := NewFixed(start)
+			Expect(clock.Now()).To(Equal(start))
+			clock.Advance(time.Minute)
+			Expect(clock.Now()).To(Equal(start.Add(time.Minute)))
+			clock.Set(start.Add(time.Hour))
+			Expect(clock.Now()).To(Equal(start.Add(time.Hour)))
+		})
+	})
+
+	Describe("Accelerated", func() {
+		It("should run speed times as fast as its source", func() {
+			source := NewFixed(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+			clock := NewAccelerated(start, 60, func(a *Accelerated) {
+				a.Source = source
+			})
+			Expect(clock.Now()).To(Equal(start))
+			source.Advance(90 * time.Second)
+			Expect(clock.Now()).To(Equal(start.Add(90 * time.Minute)))
+		})
+	})
+})
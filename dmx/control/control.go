@@ -0,0 +1,499 @@
+package control
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rltvty/go-home/dmx/default_loop"
+	"github.com/rltvty/go-home/dmx/effect"
+	"github.com/rltvty/go-home/dmx/notify"
+)
+
+//AllFixtures is the implicit group containing every fixture
+const AllFixtures = "all"
+
+//Override is a manual color that replaces the program color of a fixture
+type Override struct {
+	Color default_loop.Color `json:"color"`
+	//Until is when the override expires, zero means it lasts until resumed
+	Until time.Time `json:"until,omitempty"`
+}
+
+func (o Override) expired(now time.Time) bool {
+	return !o.Until.IsZero() && !now.Before(o.Until)
+}
+
+//EffectStatus is an effect that is running
+type EffectStatus struct {
+	Target string      `json:"target"`
+	Kind   effect.Kind `json:"kind"`
+	//Until is when the effect stops, zero means it runs until stopped
+	Until time.Time `json:"until,omitempty"`
+}
+
+//activeEffect is an effect started on a fixture or group
+type activeEffect struct {
+	target   string
+	fixtures []string
+	effect   effect.Effect
+	until    time.Time
+}
+
+func (a activeEffect) overlaps(fixtures []string) bool {
+	return overlap(a.fixtures, fixtures)
+}
+
+func (a activeEffect) expired(now time.Time) bool {
+	return !a.until.IsZero() && !now.Before(a.until)
+}
+
+//NotificationStatus is a notification that is showing or waiting for its turn
+type NotificationStatus struct {
+	Target   string    `json:"target"`
+	Name     string    `json:"name"`
+	Priority int       `json:"priority"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+//queuedNotification is a notification sent to a fixture or group
+type queuedNotification struct {
+	target       string
+	fixtures     []string
+	notification notify.Notification
+	start        time.Time
+}
+
+func (q queuedNotification) end() time.Time {
+	return q.start.Add(q.notification.Length())
+}
+
+func (q queuedNotification) overlaps(fixtures []string) bool {
+	return overlap(q.fixtures, fixtures)
+}
+
+//overlap returns whether two lists of fixtures share any fixture
+func overlap(a []string, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//FixtureStatus is the latest state of a single fixture
+type FixtureStatus struct {
+	Name     string             `json:"name"`
+	Output   default_loop.Color `json:"output"`
+	Override *Override          `json:"override,omitempty"`
+}
+
+//ZoneStatus is the program running in a single zone
+type ZoneStatus struct {
+	Name         string             `json:"name"`
+	Program      string             `json:"program"`
+	ProgramColor default_loop.Color `json:"programColor"`
+}
+
+//Status is the latest state of the programs and all fixtures
+type Status struct {
+	//Mode is the manual mode, like "away", that schedules can select programs by
+	Mode          string               `json:"mode,omitempty"`
+	Program       string               `json:"program"`
+	ProgramColor  default_loop.Color   `json:"programColor"`
+	Zones         []ZoneStatus         `json:"zones"`
+	Fixtures      []FixtureStatus      `json:"fixtures"`
+	Effects       []EffectStatus       `json:"effects"`
+	Notifications []NotificationStatus `json:"notifications"`
+}
+
+//Controller holds the deviations from the daily sequence requested over the API.  They are layered over the
+//program color, lowest first: manual colors, effects, then notifications.
+type Controller struct {
+	mu            sync.Mutex
+	fixtures      []string
+	groups        map[string][]string
+	overrides     map[string]Override
+	effects       []activeEffect
+	notifications []queuedNotification
+	mode          string
+	status        Status
+	outputs       map[string]default_loop.Color
+	zones         map[string]ZoneStatus
+}
+
+//New creates a controller for the named fixtures, with groups mapping a group name to fixture names
+func New(fixtures []string, groups map[string][]string) (*Controller, error) {
+	known := map[string]bool{}
+	for _, name := range fixtures {
+		known[name] = true
+	}
+	for group, members := range groups {
+		if known[group] || group == AllFixtures {
+			return nil, fmt.Errorf("Group name %s is already used", group)
+		}
+		for _, member := range members {
+			if !known[member] {
+				return nil, fmt.Errorf("Group %s contains unknown fixture %s", group, member)
+			}
+		}
+	}
+
+	return &Controller{
+		fixtures:  fixtures,
+		groups:    groups,
+		overrides: map[string]Override{},
+		outputs:   map[string]default_loop.Color{},
+		zones:     map[string]ZoneStatus{},
+	}, nil
+}
+
+//resolve expands a fixture or group name into fixture names
+func (c *Controller) resolve(target string) ([]string, error) {
+	if target == AllFixtures {
+		return c.fixtures, nil
+	}
+	if members, ok := c.groups[target]; ok {
+		return members, nil
+	}
+	for _, name := range c.fixtures {
+		if name == target {
+			return []string{name}, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown fixture or group: %s", target)
+}
+
+//SetColor overrides the color of a fixture or group, for duration or indefinitely if duration is zero
+func (c *Controller) SetColor(target string, color default_loop.Color, duration time.Duration, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names, err := c.resolve(target)
+	if err != nil {
+		return err
+	}
+	override := Override{Color: color}
+	if duration > 0 {
+		override.Until = now.Add(duration)
+	}
+	for _, name := range names {
+		c.overrides[name] = override
+	}
+	return nil
+}
+
+//Resume returns a fixture or group to the daily sequence
+func (c *Controller) Resume(target string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names, err := c.resolve(target)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		delete(c.overrides, name)
+	}
+	return nil
+}
+
+//Color returns the color a fixture should show, given the program color.  The fixture's effect runs over the
+//manual color or program color, and a notification that is showing replaces them all.
+func (c *Controller) Color(fixture string, program default_loop.Color, now time.Time) default_loop.Color {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	color := program
+	if override, ok := c.overrides[fixture]; ok {
+		if override.expired(now) {
+			delete(c.overrides, fixture)
+		} else {
+			color = override.Color
+		}
+	}
+
+	c.pruneEffects(now)
+	for _, active := range c.effects {
+		for i, name := range active.fixtures {
+			if name == fixture {
+				color = active.effect.Render(color, now, i, len(active.fixtures))
+			}
+		}
+	}
+
+	c.pruneNotifications(now)
+	var showing *queuedNotification
+	for i, queued := range c.notifications {
+		if queued.start.After(now) || !queued.overlaps([]string{fixture}) {
+			continue
+		}
+		if showing == nil || queued.notification.Priority > showing.notification.Priority {
+			showing = &c.notifications[i]
+		}
+	}
+	if showing != nil {
+		color, _ = showing.notification.Render(color, now.Sub(showing.start))
+	}
+	return color
+}
+
+//Notify queues a notification on a fixture or group, returning when it will start.  It waits for notifications
+//of the same or higher priority already queued on any of the fixtures to finish, and shows over those of lower
+//priority, which carry on underneath it.
+func (c *Controller) Notify(target string, n notify.Notification, now time.Time) (time.Time, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names, err := c.resolve(target)
+	if err != nil {
+		return time.Time{}, err
+	}
+	c.pruneNotifications(now)
+	start := now
+	for _, queued := range c.notifications {
+		if queued.notification.Priority >= n.Priority && queued.overlaps(names) && queued.end().After(start) {
+			start = queued.end()
+		}
+	}
+	c.notifications = append(c.notifications, queuedNotification{target: target, fixtures: names, notification: n, start: start})
+	return start, nil
+}
+
+//CancelNotifications drops the notifications showing or queued on any of the fixtures of a fixture or group, so
+//cancelling a fixture drops a notification on its group and the other way round, and "all" drops every notification
+func (c *Controller) CancelNotifications(target string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names, err := c.resolve(target)
+	if err != nil {
+		return err
+	}
+	kept := c.notifications[:0]
+	for _, queued := range c.notifications {
+		if !queued.overlaps(names) {
+			kept = append(kept, queued)
+		}
+	}
+	c.notifications = kept
+	return nil
+}
+
+func (c *Controller) pruneNotifications(now time.Time) {
+	kept := c.notifications[:0]
+	for _, queued := range c.notifications {
+		if queued.end().After(now) {
+			kept = append(kept, queued)
+		}
+	}
+	c.notifications = kept
+}
+
+//StartEffect runs an effect on a fixture or group, for duration or until stopped if duration is zero.
+//An effect already running on the same target is replaced.
+func (c *Controller) StartEffect(target string, e effect.Effect, duration time.Duration, now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names, err := c.resolve(target)
+	if err != nil {
+		return err
+	}
+	active := activeEffect{target: target, fixtures: names, effect: e}
+	active.effect.Start = now
+	if duration > 0 {
+		active.until = now.Add(duration)
+	}
+	c.removeEffects(names)
+	c.effects = append(c.effects, active)
+	return nil
+}
+
+//StopEffect stops the effects running on any of the fixtures of a fixture or group, so stopping a fixture stops
+//an effect on its group and the other way round, and "all" stops every effect
+func (c *Controller) StopEffect(target string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names, err := c.resolve(target)
+	if err != nil {
+		return err
+	}
+	c.removeEffects(names)
+	return nil
+}
+
+func (c *Controller) removeEffects(fixtures []string) {
+	kept := c.effects[:0]
+	for _, active := range c.effects {
+		if !active.overlaps(fixtures) {
+			kept = append(kept, active)
+		}
+	}
+	c.effects = kept
+}
+
+func (c *Controller) pruneEffects(now time.Time) {
+	kept := c.effects[:0]
+	for _, active := range c.effects {
+		if !active.expired(now) {
+			kept = append(kept, active)
+		}
+	}
+	c.effects = kept
+}
+
+//SetMode sets the manual mode, an empty mode clears it
+func (c *Controller) SetMode(mode string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mode = mode
+}
+
+//Mode returns the manual mode
+func (c *Controller) Mode() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mode
+}
+
+//ReportProgram records the program currently running
+func (c *Controller) ReportProgram(program string, color default_loop.Color) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.Program = program
+	c.status.ProgramColor = color
+}
+
+//ReportZone records the program currently running in a zone
+func (c *Controller) ReportZone(zone string, program string, color default_loop.Color) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.zones[zone] = ZoneStatus{Name: zone, Program: program, ProgramColor: color}
+}
+
+//ReportOutput records the color last sent to a fixture
+func (c *Controller) ReportOutput(fixture string, color default_loop.Color) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.outputs[fixture] = color
+}
+
+//Status returns the current program, output colors and active overrides
+func (c *Controller) Status(now time.Time) Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := c.status
+	status.Mode = c.mode
+	status.Zones = make([]ZoneStatus, 0, len(c.zones))
+	for _, zone := range c.zones {
+		status.Zones = append(status.Zones, zone)
+	}
+	sort.Slice(status.Zones, func(i, j int) bool { return status.Zones[i].Name < status.Zones[j].Name })
+	status.Fixtures = make([]FixtureStatus, 0, len(c.fixtures))
+	for _, name := range c.fixtures {
+		fixture := FixtureStatus{Name: name, Output: c.outputs[name]}
+		if override, ok := c.overrides[name]; ok && !override.expired(now) {
+			fixture.Override = &override
+		}
+		status.Fixtures = append(status.Fixtures, fixture)
+	}
+	status.Effects = []EffectStatus{}
+	for _, active := range c.effects {
+		if !active.expired(now) {
+			status.Effects = append(status.Effects, EffectStatus{Target: active.target, Kind: active.effect.Kind, Until: active.until})
+		}
+	}
+	status.Notifications = []NotificationStatus{}
+	for _, queued := range c.notifications {
+		if queued.end().After(now) {
+			status.Notifications = append(status.Notifications, NotificationStatus{
+				Target:   queued.target,
+				Name:     queued.notification.Name,
+				Priority: queued.notification.Priority,
+				Start:    queued.start,
+				End:      queued.end(),
+			})
+		}
+	}
+	return status
+}
+
+//Snapshot is the state of the controller that is saved across restarts
+type Snapshot struct {
+	//Saved is when the snapshot was taken, so stale outputs can be told apart
+	Saved     time.Time                     `json:"saved"`
+	Mode      string                        `json:"mode,omitempty"`
+	Overrides map[string]Override           `json:"overrides"`
+	Outputs   map[string]default_loop.Color `json:"outputs"`
+}
+
+//Snapshot returns the mode, the overrides that haven't expired and the last output of each fixture
+func (c *Controller) Snapshot(now time.Time) Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	snapshot := Snapshot{
+		Saved:     now,
+		Mode:      c.mode,
+		Overrides: map[string]Override{},
+		Outputs:   map[string]default_loop.Color{},
+	}
+	for name, override := range c.overrides {
+		if !override.expired(now) {
+			snapshot.Overrides[name] = override
+		}
+	}
+	for name, color := range c.outputs {
+		snapshot.Outputs[name] = color
+	}
+	return snapshot
+}
+
+//Restore puts back the mode, overrides and outputs of a snapshot, skipping fixtures that no longer exist and
+//overrides that have expired
+func (c *Controller) Restore(snapshot Snapshot, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	known := map[string]bool{}
+	for _, name := range c.fixtures {
+		known[name] = true
+	}
+	c.mode = snapshot.Mode
+	for name, override := range snapshot.Overrides {
+		if known[name] && !override.expired(now) {
+			c.overrides[name] = override
+		}
+	}
+	for name, color := range snapshot.Outputs {
+		if known[name] {
+			c.outputs[name] = color
+		}
+	}
+}
+
+//Groups lists the group names, including the implicit "all" group
+func (c *Controller) Groups() map[string][]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	groups := map[string][]string{AllFixtures: sorted(c.fixtures)}
+	for name, members := range c.groups {
+		groups[name] = sorted(members)
+	}
+	return groups
+}
+
+func sorted(names []string) []string {
+	out := append([]string{}, names...)
+	sort.Strings(out)
+	return out
+}
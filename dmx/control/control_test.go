@@ -0,0 +1,270 @@
+package control_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/rltvty/go-home/dmx/control"
+	"github.com/rltvty/go-home/dmx/default_loop"
+	"github.com/rltvty/go-home/dmx/effect"
+	"github.com/rltvty/go-home/dmx/notify"
+)
+
+var _ = Describe("Controller", func() {
+	now := time.Date(2019, 6, 1, 22, 0, 0, 0, time.UTC)
+	program := default_loop.Color{Red: 150, UV: 150}
+	manual := default_loop.Color{White: 255}
+	var controller *Controller
+
+	BeforeEach(func() {
+		var err error
+		controller, err = New([]string{"sink", "shower", "hall"}, map[string][]string{
+			"bathroom": {"sink", "shower"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Describe("New", func() {
+		It("should reject groups with unknown fixtures", func() {
+			_, err := New([]string{"sink"}, map[string][]string{"bathroom": {"sink", "tub"}})
+			Expect(err).To(MatchError("Group bathroom contains unknown fixture tub"))
+		})
+
+		It("should reject groups that shadow a fixture", func() {
+			_, err := New([]string{"sink"}, map[string][]string{"sink": {"sink"}})
+			Expect(err).To(MatchError("Group name sink is already used"))
+		})
+	})
+
+	Describe("SetColor", func() {
+		It("should override every fixture in a group", func() {
+			Expect(controller.SetColor("bathroom", manual, 0, now)).To(Succeed())
+			Expect(controller.Color("sink", program, now)).To(Equal(manual))
+			Expect(controller.Color("shower", program, now)).To(Equal(manual))
+			Expect(controller.Color("hall", program, now)).To(Equal(program))
+		})
+
+		It("should expire after the duration", func() {
+			Expect(controller.SetColor("sink", manual, time.Minute, now)).To(Succeed())
+			Expect(controller.Color("sink", program, now.Add(59*time.Second))).To(Equal(manual))
+			Expect(controller.Color("sink", program, now.Add(time.Minute))).To(Equal(program))
+		})
+
+		It("should error on unknown targets", func() {
+			Expect(controller.SetColor("tub", manual, 0, now)).To(MatchError("Unknown fixture or group: tub"))
+		})
+	})
+
+	Describe("Resume", func() {
+		It("should return fixtures to the program", func() {
+			Expect(controller.SetColor(AllFixtures, manual, 0, now)).To(Succeed())
+			Expect(controller.Resume("shower")).To(Succeed())
+			Expect(controller.Color("sink", program, now)).To(Equal(manual))
+			Expect(controller.Color("shower", program, now)).To(Equal(program))
+			Expect(controller.Resume(AllFixtures)).To(Succeed())
+			Expect(controller.Color("sink", program, now)).To(Equal(program))
+		})
+	})
+
+	Describe("Effects", func() {
+		strobe := effect.Effect{Kind: effect.Strobe, Period: time.Second, Blend: effect.Replace, Color: &manual}
+
+		It("should run over the program and manual colors until stopped", func() {
+			Expect(controller.StartEffect("bathroom", strobe, 0, now)).To(Succeed())
+			Expect(controller.Color("sink", program, now)).To(Equal(manual))
+			Expect(controller.Color("sink", program, now.Add(500*time.Millisecond))).To(Equal(default_loop.Color{}))
+			Expect(controller.Color("hall", program, now.Add(500*time.Millisecond))).To(Equal(program))
+
+			Expect(controller.SetColor("sink", default_loop.Color{Blue: 10}, 0, now)).To(Succeed())
+			Expect(controller.Color("sink", program, now.Add(500*time.Millisecond))).To(Equal(default_loop.Color{}))
+
+			Expect(controller.StopEffect("bathroom")).To(Succeed())
+			Expect(controller.Color("sink", program, now.Add(500*time.Millisecond))).To(Equal(default_loop.Color{Blue: 10}))
+		})
+
+		It("should stop after the duration", func() {
+			Expect(controller.StartEffect("sink", strobe, time.Minute, now)).To(Succeed())
+			Expect(controller.Status(now).Effects).To(Equal([]EffectStatus{{Target: "sink", Kind: effect.Strobe, Until: now.Add(time.Minute)}}))
+			Expect(controller.Color("sink", program, now.Add(time.Minute))).To(Equal(program))
+			Expect(controller.Status(now.Add(time.Minute)).Effects).To(BeEmpty())
+		})
+
+		It("should replace effects on the same fixtures, and run effects on others alongside", func() {
+			breathe := effect.Effect{Kind: effect.Breathe, Period: time.Second, Depth: 1, Blend: effect.Replace}
+			Expect(controller.StartEffect("sink", strobe, 0, now)).To(Succeed())
+			Expect(controller.StartEffect("sink", breathe, 0, now)).To(Succeed())
+			Expect(controller.StartEffect("hall", strobe, 0, now)).To(Succeed())
+			Expect(controller.Status(now).Effects).To(HaveLen(2))
+			Expect(controller.StartEffect("bathroom", strobe, 0, now)).To(Succeed())
+			Expect(controller.Status(now).Effects).To(HaveLen(2))
+			Expect(controller.StartEffect("shower", breathe, 0, now)).To(Succeed())
+			Expect(controller.Status(now).Effects).To(Equal([]EffectStatus{
+				{Target: "hall", Kind: effect.Strobe},
+				{Target: "shower", Kind: effect.Breathe},
+			}))
+			Expect(controller.StopEffect(AllFixtures)).To(Succeed())
+			Expect(controller.Status(now).Effects).To(BeEmpty())
+		})
+
+		It("should stop a group effect through one of its zones", func() {
+			zoned, err := New([]string{"sink", "shower"}, map[string][]string{
+				"bathroom-sink":   {"sink"},
+				"bathroom-shower": {"shower"},
+				"bathroom":        {"sink", "shower"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(zoned.StartEffect("bathroom", strobe, 0, now)).To(Succeed())
+			Expect(zoned.StopEffect("bathroom-sink")).To(Succeed())
+			Expect(zoned.Status(now).Effects).To(BeEmpty())
+			Expect(zoned.Color("shower", program, now)).To(Equal(program))
+		})
+
+		It("should error on unknown targets", func() {
+			Expect(controller.StartEffect("garage", strobe, 0, now)).To(MatchError("Unknown fixture or group: garage"))
+			Expect(controller.StopEffect("garage")).To(MatchError("Unknown fixture or group: garage"))
+		})
+	})
+
+	Describe("Notify", func() {
+		blue := default_loop.Color{Blue: 255}
+		blink := notify.Notification{Name: "washer", Priority: 5, Steps: []notify.Step{
+			{Color: &blue, Duration: time.Second}, {Color: &default_loop.Color{}, Duration: time.Second},
+		}}
+
+		It("should show over everything, then return to the scheduled color", func() {
+			Expect(controller.SetColor("shower", manual, 0, now)).To(Succeed())
+			Expect(controller.StartEffect("shower", effect.Effect{Kind: effect.Strobe, Period: time.Second, Blend: effect.Replace}, 0, now)).To(Succeed())
+			Expect(controller.StopEffect("shower")).To(Succeed())
+
+			start, err := controller.Notify("bathroom", blink, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(start).To(Equal(now))
+			Expect(controller.Color("sink", program, now)).To(Equal(blue))
+			Expect(controller.Color("shower", program, now.Add(1500*time.Millisecond))).To(Equal(default_loop.Color{}))
+			Expect(controller.Color("hall", program, now)).To(Equal(program))
+			Expect(controller.Color("sink", program, now.Add(2*time.Second))).To(Equal(program))
+			Expect(controller.Color("shower", program, now.Add(2*time.Second))).To(Equal(manual))
+		})
+
+		It("should queue notifications of the same priority", func() {
+			_, err := controller.Notify("sink", blink, now)
+			Expect(err).NotTo(HaveOccurred())
+			start, err := controller.Notify("bathroom", blink, now.Add(time.Second))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(start).To(Equal(now.Add(2 * time.Second)))
+			Expect(controller.Status(now.Add(time.Second)).Notifications).To(Equal([]NotificationStatus{
+				{Target: "sink", Name: "washer", Priority: 5, Start: now, End: now.Add(2 * time.Second)},
+				{Target: "bathroom", Name: "washer", Priority: 5, Start: now.Add(2 * time.Second), End: now.Add(4 * time.Second)},
+			}))
+
+			Expect(controller.Color("shower", program, now.Add(time.Second))).To(Equal(program))
+			Expect(controller.Color("shower", program, now.Add(2*time.Second))).To(Equal(blue))
+		})
+
+		It("should show higher priority notifications straight away", func() {
+			white := default_loop.Color{White: 255}
+			doorbell := notify.Notification{Name: "doorbell", Priority: 20, Steps: []notify.Step{{Color: &white, Duration: time.Second}}}
+			_, err := controller.Notify("sink", blink, now)
+			Expect(err).NotTo(HaveOccurred())
+			start, err := controller.Notify("sink", doorbell, now.Add(500*time.Millisecond))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(start).To(Equal(now.Add(500 * time.Millisecond)))
+			Expect(controller.Color("sink", program, now.Add(500*time.Millisecond))).To(Equal(white))
+			Expect(controller.Color("sink", program, now.Add(1600*time.Millisecond))).To(Equal(default_loop.Color{}))
+		})
+
+		It("should cancel notifications", func() {
+			_, err := controller.Notify("sink", blink, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(controller.CancelNotifications("hall")).To(Succeed())
+			Expect(controller.Status(now).Notifications).To(HaveLen(1))
+			Expect(controller.CancelNotifications(AllFixtures)).To(Succeed())
+			Expect(controller.Color("sink", program, now)).To(Equal(program))
+			Expect(controller.CancelNotifications("garage")).To(MatchError("Unknown fixture or group: garage"))
+		})
+
+		It("should cancel notifications on a group by fixture, and on a fixture by group", func() {
+			_, err := controller.Notify("bathroom", blink, now)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = controller.Notify("hall", blink, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(controller.CancelNotifications("sink")).To(Succeed())
+			Expect(controller.Status(now).Notifications).To(HaveLen(1))
+			Expect(controller.Status(now).Notifications[0].Target).To(Equal("hall"))
+
+			_, err = controller.Notify("shower", blink, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(controller.CancelNotifications("bathroom")).To(Succeed())
+			Expect(controller.Color("shower", program, now)).To(Equal(program))
+			Expect(controller.Status(now).Notifications).To(HaveLen(1))
+		})
+
+		It("should error on unknown targets", func() {
+			_, err := controller.Notify("garage", blink, now)
+			Expect(err).To(MatchError("Unknown fixture or group: garage"))
+		})
+	})
+
+	Describe("Status", func() {
+		It("should report the program, outputs and active overrides", func() {
+			controller.ReportProgram("night", program)
+			controller.ReportOutput("sink", manual)
+			Expect(controller.SetColor("sink", manual, time.Hour, now)).To(Succeed())
+
+			status := controller.Status(now)
+			Expect(status.Program).To(Equal("night"))
+			Expect(status.ProgramColor).To(Equal(program))
+			Expect(status.Fixtures).To(HaveLen(3))
+			Expect(status.Fixtures[0].Name).To(Equal("sink"))
+			Expect(status.Fixtures[0].Output).To(Equal(manual))
+			Expect(*status.Fixtures[0].Override).To(Equal(Override{Color: manual, Until: now.Add(time.Hour)}))
+			Expect(status.Fixtures[1].Override).To(BeNil())
+		})
+
+		It("should report the program of each zone in order", func() {
+			controller.ReportZone("shower", "day", manual)
+			controller.ReportZone("bathroom", "night", program)
+			controller.ReportZone("shower", "night", program)
+
+			Expect(controller.Status(now).Zones).To(Equal([]ZoneStatus{
+				{Name: "bathroom", Program: "night", ProgramColor: program},
+				{Name: "shower", Program: "night", ProgramColor: program},
+			}))
+		})
+
+		It("should report the manual mode", func() {
+			controller.SetMode("away")
+			Expect(controller.Mode()).To(Equal("away"))
+			Expect(controller.Status(now).Mode).To(Equal("away"))
+			controller.SetMode("")
+			Expect(controller.Status(now).Mode).To(BeEmpty())
+		})
+	})
+
+	Describe("Snapshot", func() {
+		It("should restore the mode, overrides and outputs", func() {
+			controller.SetMode("away")
+			controller.SetColor("sink", manual, 0, now)
+			controller.SetColor("shower", manual, time.Minute, now)
+			controller.ReportOutput("sink", manual)
+			snapshot := controller.Snapshot(now)
+			Expect(snapshot.Saved).To(Equal(now))
+
+			restored, _ := New([]string{"sink", "shower", "tub"}, map[string][]string{})
+			restored.Restore(snapshot, now.Add(time.Hour))
+			status := restored.Status(now.Add(time.Hour))
+			Expect(status.Mode).To(Equal("away"))
+			Expect(*status.Fixtures[0].Override).To(Equal(Override{Color: manual}))
+			Expect(status.Fixtures[0].Output).To(Equal(manual))
+			Expect(status.Fixtures[1].Override).To(BeNil())
+		})
+
+		It("should skip fixtures that no longer exist", func() {
+			restored, _ := New([]string{"tub"}, map[string][]string{})
+			restored.Restore(Snapshot{Overrides: map[string]Override{"sink": {Color: manual}}}, now)
+			Expect(restored.Snapshot(now).Overrides).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,360 @@
+package default_loop
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+)
+
+//XYZ is a CIE 1931 tristimulus value.  Y is luminance relative to the reference white emitter at full.
+type XYZ struct {
+	X float64
+	Y float64
+	Z float64
+}
+
+func (c XYZ) add(other XYZ, scale float64) XYZ {
+	return XYZ{X: c.X + other.X*scale, Y: c.Y + other.Y*scale, Z: c.Z + other.Z*scale}
+}
+
+//Chromaticity returns the CIE xy coordinates of the color
+func (c XYZ) Chromaticity() (float64, float64) {
+	sum := c.X + c.Y + c.Z
+	if sum == 0 {
+		return 0, 0
+	}
+	return c.X / sum, c.Y / sum
+}
+
+//FromChromaticity converts CIE xy coordinates and a luminance into XYZ
+func FromChromaticity(x float64, y float64, luminance float64) XYZ {
+	if y <= 0 {
+		return XYZ{}
+	}
+	return XYZ{X: x / y * luminance, Y: luminance, Z: (1 - x - y) / y * luminance}
+}
+
+//Emitter is the color of one kind of LED on a fixture, and its luminance at full level
+type Emitter struct {
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Luminance float64 `json:"luminance"`
+}
+
+func (e Emitter) xyz() XYZ {
+	return FromChromaticity(e.X, e.Y, e.Luminance)
+}
+
+//Calibration describes the emitters of a fixture, so colors can be mixed from them.  A nil emitter is one the
+//fixture doesn't have.  UV is passed through untouched, as it barely registers as visible light.
+type Calibration struct {
+	Red   *Emitter `json:"red"`
+	Green *Emitter `json:"green"`
+	Blue  *Emitter `json:"blue"`
+	White *Emitter `json:"white"`
+	Amber *Emitter `json:"amber"`
+}
+
+//Reference is a typical RGBWA fixture.  Colors built from kelvin, HSV or xy are mixed for it, and a fixture with
+//its own calibration converts them to look the same on its emitters.
+var Reference = Calibration{
+	Red:   &Emitter{X: 0.700, Y: 0.299, Luminance: 0.30},
+	Green: &Emitter{X: 0.170, Y: 0.700, Luminance: 0.60},
+	Blue:  &Emitter{X: 0.135, Y: 0.040, Luminance: 0.10},
+	White: &Emitter{X: 0.3127, Y: 0.3290, Luminance: 1},
+	Amber: &Emitter{X: 0.575, Y: 0.424, Luminance: 0.50},
+}
+
+//Validate checks the calibration has the red, green and blue emitters every mix starts from
+func (c Calibration) Validate() error {
+	if c.Red == nil || c.Green == nil || c.Blue == nil {
+		return errors.New("Calibration needs red, green and blue emitters")
+	}
+	if _, ok := invert(c.rgb()); !ok {
+		return errors.New("Calibration red, green and blue emitters can't be mixed")
+	}
+	return nil
+}
+
+func (c Calibration) rgb() [3][3]float64 {
+	r, g, b := c.Red.xyz(), c.Green.xyz(), c.Blue.xyz()
+	return [3][3]float64{
+		{r.X, g.X, b.X},
+		{r.Y, g.Y, b.Y},
+		{r.Z, g.Z, b.Z},
+	}
+}
+
+//XYZ is the light the fixture gives off showing color
+func (c Calibration) XYZ(color Color) XYZ {
+	var out XYZ
+	for _, channel := range []struct {
+		emitter *Emitter
+		level   byte
+	}{{c.Red, color.Red}, {c.Green, color.Green}, {c.Blue, color.Blue}, {c.White, color.White}, {c.Amber, color.Amber}} {
+		if channel.emitter != nil {
+			out = out.add(channel.emitter.xyz(), float64(channel.level)/255)
+		}
+	}
+	return out
+}
+
+//Mix finds the channel levels that best reproduce target.  White, then amber, take as much of the color as they
+//can, with red, green and blue making up the rest.  A target brighter than the fixture can go is dimmed, keeping
+//its chromaticity.
+func (c Calibration) Mix(target XYZ) Color {
+	inverse, ok := invert(c.rgb())
+	if !ok {
+		return Color{}
+	}
+	solve := func(t XYZ) [3]float64 {
+		return multiply(inverse, [3]float64{t.X, t.Y, t.Z})
+	}
+
+	residual := target
+	extra := map[*Emitter]float64{}
+	for _, emitter := range []*Emitter{c.White, c.Amber} {
+		if emitter == nil {
+			continue
+		}
+		//the rgb mix of what's left goes down by direction for each unit of this emitter, and can't go negative
+		base, direction := solve(residual), solve(emitter.xyz())
+		level := 1.0
+		for i := range base {
+			if direction[i] > 0 {
+				level = math.Min(level, base[i]/direction[i])
+			}
+		}
+		level = math.Max(level, 0)
+		extra[emitter] = level
+		residual = residual.add(emitter.xyz(), -level)
+	}
+
+	rgb := solve(residual)
+	levels := []float64{math.Max(rgb[0], 0), math.Max(rgb[1], 0), math.Max(rgb[2], 0), extra[c.White], extra[c.Amber]}
+	highest := 1.0
+	for _, level := range levels {
+		highest = math.Max(highest, level)
+	}
+	toByte := func(level float64) byte {
+		return roundByte(level / highest * 255)
+	}
+	return Color{
+		Red:   toByte(levels[0]),
+		Green: toByte(levels[1]),
+		Blue:  toByte(levels[2]),
+		White: toByte(levels[3]),
+		Amber: toByte(levels[4]),
+	}
+}
+
+//Convert maps a color written for the Reference fixture onto this one, so it looks the same
+func (c Calibration) Convert(color Color) Color {
+	converted := c.Mix(Reference.XYZ(color))
+	converted.UV = color.UV
+	return converted
+}
+
+//XY builds a color from CIE xy chromaticity coordinates, at level (0-1) of the reference white's luminance
+func XY(x float64, y float64, level float64) Color {
+	return Reference.Mix(FromChromaticity(x, y, level))
+}
+
+//Kelvin builds a color on the black body curve, like 2700 for a warm incandescent, at level (0-1).
+//Temperatures are limited to 1667K-25000K, the range of the approximation used.
+func Kelvin(kelvin float64, level float64) Color {
+	x, y := kelvinChromaticity(kelvin)
+	return XY(x, y, level)
+}
+
+//kelvinChromaticity approximates the Planckian locus with the cubic splines of Kim et al.
+func kelvinChromaticity(kelvin float64) (float64, float64) {
+	t := math.Max(1667, math.Min(25000, kelvin))
+	var x float64
+	if t <= 4000 {
+		x = -0.2661239e9/(t*t*t) - 0.2343589e6/(t*t) + 0.8776956e3/t + 0.179910
+	} else {
+		x = -3.0258469e9/(t*t*t) + 2.1070379e6/(t*t) + 0.2226347e3/t + 0.240390
+	}
+	var y float64
+	switch {
+	case t <= 2222:
+		y = -1.1063814*x*x*x - 1.34811020*x*x + 2.18555832*x - 0.20219683
+	case t <= 4000:
+		y = -0.9549476*x*x*x - 1.37418593*x*x + 2.09137015*x - 0.16748867
+	default:
+		y = 3.0817580*x*x*x - 5.87338670*x*x + 3.75112997*x - 0.37001483
+	}
+	return x, y
+}
+
+//HSV builds a color from an sRGB hue (degrees), saturation and value (0-1).  Full value white is as bright as
+//the reference white emitter.
+func HSV(hue float64, saturation float64, value float64) Color {
+	hue = math.Mod(math.Mod(hue, 360)+360, 360)
+	chroma := value * saturation
+	second := chroma * (1 - math.Abs(math.Mod(hue/60, 2)-1))
+	var r, g, b float64
+	switch {
+	case hue < 60:
+		r, g = chroma, second
+	case hue < 120:
+		r, g = second, chroma
+	case hue < 180:
+		g, b = chroma, second
+	case hue < 240:
+		g, b = second, chroma
+	case hue < 300:
+		r, b = second, chroma
+	default:
+		r, b = chroma, second
+	}
+	m := value - chroma
+	r, g, b = linear(r+m), linear(g+m), linear(b+m)
+
+	//sRGB to XYZ, D65
+	return Reference.Mix(XYZ{
+		X: 0.4124*r + 0.3576*g + 0.1805*b,
+		Y: 0.2126*r + 0.7152*g + 0.0722*b,
+		Z: 0.0193*r + 0.1192*g + 0.9505*b,
+	})
+}
+
+//SRGB is roughly how a color looks on the reference fixture, as an sRGB color for screens.  The reference white
+//emitter at full is sRGB white, brighter colors are dimmed to fit, keeping their hue.  UV isn't shown.
+func SRGB(color Color) (byte, byte, byte) {
+	c := Reference.XYZ(color)
+	//XYZ to linear sRGB, D65
+	rgb := [3]float64{
+		3.2406*c.X - 1.5372*c.Y - 0.4986*c.Z,
+		-0.9689*c.X + 1.8758*c.Y + 0.0415*c.Z,
+		0.0557*c.X - 0.2040*c.Y + 1.0570*c.Z,
+	}
+	brightest := 1.0
+	for i := range rgb {
+		rgb[i] = math.Max(0, rgb[i])
+		brightest = math.Max(brightest, rgb[i])
+	}
+	var out [3]byte
+	for i := range rgb {
+		out[i] = roundByte(255 * gammaEncode(rgb[i]/brightest))
+	}
+	return out[0], out[1], out[2]
+}
+
+//gammaEncode applies the sRGB transfer curve
+func gammaEncode(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+//linear undoes the sRGB transfer curve
+func linear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func invert(m [3][3]float64) ([3][3]float64, bool) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if math.Abs(det) < 1e-12 {
+		return m, false
+	}
+	var inverse [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			//the cofactor of m[j][i], using the cyclic order of the other rows and columns
+			a, b := (j+1)%3, (j+2)%3
+			c, d := (i+1)%3, (i+2)%3
+			inverse[i][j] = (m[a][c]*m[b][d] - m[a][d]*m[b][c]) / det
+		}
+	}
+	return inverse, true
+}
+
+func multiply(m [3][3]float64, v [3]float64) [3]float64 {
+	return [3]float64{
+		m[0][0]*v[0] + m[0][1]*v[1] + m[0][2]*v[2],
+		m[1][0]*v[0] + m[1][1]*v[1] + m[1][2]*v[2],
+		m[2][0]*v[0] + m[2][1]*v[1] + m[2][2]*v[2],
+	}
+}
+
+//colorJSON is a color written as channels, or as one of kelvin, hsv or xy
+type colorJSON struct {
+	Red        *byte    `json:"red"`
+	Blue       *byte    `json:"blue"`
+	Green      *byte    `json:"green"`
+	White      *byte    `json:"white"`
+	Amber      *byte    `json:"amber"`
+	UV         *byte    `json:"uv"`
+	Kelvin     *float64 `json:"kelvin"`
+	Hue        *float64 `json:"hue"`
+	Saturation *float64 `json:"saturation"`
+	X          *float64 `json:"x"`
+	Y          *float64 `json:"y"`
+	//Level is the brightness (0-1) for kelvin, hsv and xy colors, defaulting to full
+	Level *float64 `json:"level"`
+}
+
+//UnmarshalJSON reads channel levels like {"red": 255, "uv": 100}, or a built color like {"kelvin": 2700, "level": 0.4},
+//{"hue": 30, "saturation": 1, "level": 0.5} or {"x": 0.45, "y": 0.41, "level": 1}
+func (c *Color) UnmarshalJSON(data []byte) error {
+	var in colorJSON
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&in); err != nil {
+		return err
+	}
+
+	level := 1.0
+	if in.Level != nil {
+		level = *in.Level
+	}
+	if level < 0 || level > 1 {
+		return errors.New("Color level must be between 0 and 1")
+	}
+	channels := in.Red != nil || in.Green != nil || in.Blue != nil || in.White != nil || in.Amber != nil || in.UV != nil
+	built := 0
+	for _, set := range []bool{in.Kelvin != nil, in.Hue != nil || in.Saturation != nil, in.X != nil || in.Y != nil} {
+		if set {
+			built++
+		}
+	}
+	if built > 1 || (built == 1 && channels) {
+		return errors.New("Color must be one of channels, kelvin, hue and saturation, or x and y")
+	}
+
+	switch {
+	case in.Kelvin != nil:
+		*c = Kelvin(*in.Kelvin, level)
+	case in.Hue != nil || in.Saturation != nil:
+		if in.Hue == nil || in.Saturation == nil {
+			return errors.New("Color needs both hue and saturation")
+		}
+		*c = HSV(*in.Hue, *in.Saturation, level)
+	case in.X != nil || in.Y != nil:
+		if in.X == nil || in.Y == nil {
+			return errors.New("Color needs both x and y")
+		}
+		*c = XY(*in.X, *in.Y, level)
+	default:
+		if in.Level != nil {
+			return errors.New("Color level needs kelvin, hue and saturation, or x and y")
+		}
+		value := func(level *byte) byte {
+			if level == nil {
+				return 0
+			}
+			return *level
+		}
+		*c = Color{Red: value(in.Red), Green: value(in.Green), Blue: value(in.Blue), White: value(in.White), Amber: value(in.Amber), UV: value(in.UV)}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package default_loop_test
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	. "github.com/rltvty/go-home/dmx/default_loop"
+)
+
+//expectLooksLike checks the color shows at chromaticity x, y and luminance on the reference fixture
+func expectLooksLike(color Color, x float64, y float64, luminance float64) {
+	xyz := Reference.XYZ(color)
+	actualX, actualY := xyz.Chromaticity()
+	ExpectWithOffset(1, actualX).To(BeNumerically("~", x, 0.005))
+	ExpectWithOffset(1, actualY).To(BeNumerically("~", y, 0.005))
+	ExpectWithOffset(1, xyz.Y).To(BeNumerically("~", luminance, 0.01))
+}
+
+var _ = Describe("Color", func() {
+	DescribeTable("Kelvin",
+		func(kelvin float64, x float64, y float64) {
+			expectLooksLike(Kelvin(kelvin, 0.4), x, y, 0.4)
+		},
+		Entry("candle light", 2200.0, 0.5018, 0.4153),
+		Entry("incandescent", 2700.0, 0.4599, 0.4106),
+		Entry("halogen", 3200.0, 0.4234, 0.3990),
+		Entry("daylight", 5000.0, 0.3451, 0.3516),
+		Entry("overcast", 6500.0, 0.3135, 0.3237),
+	)
+
+	It("should make warm whites mostly from amber, with some white", func() {
+		warm := Kelvin(2700, 0.4)
+		Expect(warm.White).To(BeNumerically(">", 0))
+		Expect(warm.Amber).To(BeNumerically(">", warm.White))
+		Expect(warm.Amber).To(BeNumerically(">", warm.Green))
+		Expect(warm.Blue).To(BeNumerically("<", 5))
+	})
+
+	It("should make the reference white from the white emitter alone", func() {
+		Expect(XY(0.3127, 0.3290, 1)).To(Equal(Color{White: 255}))
+	})
+
+	It("should dim colors brighter than the fixture can go", func() {
+		//the blue emitter only gives a tenth of the white's luminance
+		blue := XY(0.14, 0.05, 1)
+		Expect(blue.Blue).To(BeNumerically("==", 255))
+		expectLooksLike(blue, 0.14, 0.05, Reference.XYZ(blue).Y)
+		Expect(Reference.XYZ(blue).Y).To(BeNumerically("<", 0.2))
+	})
+
+	DescribeTable("HSV",
+		func(hue float64, saturation float64, x float64, y float64) {
+			color := HSV(hue, saturation, 1)
+			xyz := Reference.XYZ(color)
+			actualX, actualY := xyz.Chromaticity()
+			Expect(actualX).To(BeNumerically("~", x, 0.005))
+			Expect(actualY).To(BeNumerically("~", y, 0.005))
+		},
+		Entry("white", 0.0, 0.0, 0.3127, 0.3290),
+		Entry("sRGB red", 0.0, 1.0, 0.64, 0.33),
+		Entry("sRGB green", 120.0, 1.0, 0.30, 0.60),
+		Entry("sRGB blue", 240.0, 1.0, 0.15, 0.06),
+		Entry("hues wrap around", 360.0, 1.0, 0.64, 0.33),
+	)
+
+	Describe("Calibration", func() {
+		rgbw := Calibration{
+			Red:   &Emitter{X: 0.690, Y: 0.305, Luminance: 0.25},
+			Green: &Emitter{X: 0.165, Y: 0.710, Luminance: 0.70},
+			Blue:  &Emitter{X: 0.140, Y: 0.045, Luminance: 0.12},
+			White: &Emitter{X: 0.330, Y: 0.340, Luminance: 1.2},
+		}
+
+		It("should give the same look on a fixture without amber", func() {
+			warm := Kelvin(2700, 0.4)
+			converted := rgbw.Convert(warm)
+			Expect(converted.Amber).To(BeNumerically("==", 0))
+			xyz := rgbw.XYZ(converted)
+			x, y := xyz.Chromaticity()
+			Expect(x).To(BeNumerically("~", 0.4599, 0.005))
+			Expect(y).To(BeNumerically("~", 0.4106, 0.005))
+			Expect(xyz.Y).To(BeNumerically("~", 0.4, 0.01))
+		})
+
+		It("should pass UV through", func() {
+			Expect(rgbw.Convert(Color{UV: 200}).UV).To(BeNumerically("==", 200))
+		})
+
+		It("should validate its emitters", func() {
+			Expect(Reference.Validate()).To(Succeed())
+			Expect(Calibration{White: Reference.White}.Validate()).To(MatchError("Calibration needs red, green and blue emitters"))
+		})
+	})
+
+	Describe("SRGB", func() {
+		It("should show off as black", func() {
+			r, g, b := SRGB(Color{})
+			Expect([]byte{r, g, b}).To(Equal([]byte{0, 0, 0}))
+		})
+
+		It("should show hsv colors as themselves", func() {
+			r, g, b := SRGB(HSV(0, 1, 1))
+			Expect(r).To(BeNumerically("~", 255, 10))
+			Expect(g).To(BeNumerically("~", 0, 10))
+			Expect(b).To(BeNumerically("~", 0, 10))
+		})
+	})
+
+	Describe("UnmarshalJSON", func() {
+		parse := func(text string) (Color, error) {
+			var color Color
+			err := json.Unmarshal([]byte(text), &color)
+			return color, err
+		}
+
+		It("should read channels", func() {
+			Expect(parse(`{"red": 255, "uv": 10}`)).To(Equal(Color{Red: 255, UV: 10}))
+		})
+
+		It("should read kelvin, hsv and xy", func() {
+			Expect(parse(`{"kelvin": 2700, "level": 0.4}`)).To(Equal(Kelvin(2700, 0.4)))
+			Expect(parse(`{"hue": 30, "saturation": 0.8, "level": 0.5}`)).To(Equal(HSV(30, 0.8, 0.5)))
+			Expect(parse(`{"x": 0.45, "y": 0.41}`)).To(Equal(XY(0.45, 0.41, 1)))
+		})
+
+		DescribeTable("rejecting invalid colors",
+			func(text string, message string) {
+				_, err := parse(text)
+				Expect(err).To(MatchError(message))
+			},
+			Entry("mixed forms", `{"kelvin": 2700, "red": 10}`, "Color must be one of channels, kelvin, hue and saturation, or x and y"),
+			Entry("half of hsv", `{"hue": 30}`, "Color needs both hue and saturation"),
+			Entry("half of xy", `{"x": 0.3}`, "Color needs both x and y"),
+			Entry("level too high", `{"kelvin": 2700, "level": 40}`, "Color level must be between 0 and 1"),
+			Entry("level on channels", `{"red": 10, "level": 0.5}`, "Color level needs kelvin, hue and saturation, or x and y"),
+		)
+
+		It("should reject unknown fields", func() {
+			_, err := parse(`{"purple": 10}`)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -13,12 +13,12 @@ import (
 //Dusk
 
 type Color struct {
-	Red byte
-	Blue byte
-	Green byte
-	White byte
-	Amber byte
-	UV byte
+	Red   byte `json:"red"`
+	Blue  byte `json:"blue"`
+	Green byte `json:"green"`
+	White byte `json:"white"`
+	Amber byte `json:"amber"`
+	UV    byte `json:"uv"`
 }
 
 func (c Color) String() string {
@@ -27,106 +27,114 @@ func (c Color) String() string {
 
 type Setting struct {
 	Color Color
-	Time time.Time
+	Time  time.Time
 }
 
-func preDawnColor(now time.Time, events astronomy.Events) Color {
-	red := 10
-	if localSeconds(now) > localSeconds(events.Dawn) - 3600 {
-		secondsUntilDawn := localSeconds(events.Dawn) - localSeconds(now)
-		ratio := float32(3600 - secondsUntilDawn)/3600.0
-		red += int(ratio * 100)
-	}
+//phaseFade is how long the program takes to fade between phases
+const phaseFade = 15 * time.Minute
 
-	return Color{
-		Red:   byte(red),
-		Blue:  0,
-		Green: 0,
-		White: 0,
-		Amber: 0,
-		UV:    0,
-	}
+//dawnRamp is how long before civil dawn the pre-dawn red starts brightening
+const dawnRamp = time.Hour
+
+var preDawnColor = Color{
+	Red:   10,
+	Blue:  0,
+	Green: 0,
+	White: 0,
+	Amber: 0,
+	UV:    0,
 }
 
-func wakeColor(now time.Time, events astronomy.Events) Color {
-	return Color{
-		Red:   0,
-		Blue:  100,
-		Green: 100,
-		White: 0,
-		Amber: 0,
-		UV:    255,
-	}
+var dawnColor = Color{
+	Red:   110,
+	Blue:  0,
+	Green: 0,
+	White: 0,
+	Amber: 0,
+	UV:    0,
 }
 
-func morningColor(now time.Time, events astronomy.Events) Color {
-	return Color{
-		Red:   0,
-		Blue:  255,
-		Green: 255,
-		White: 0,
-		Amber: 0,
-		UV:    255,
-	}
+var wakeColor = Color{
+	Red:   0,
+	Blue:  100,
+	Green: 100,
+	White: 0,
+	Amber: 0,
+	UV:    255,
 }
 
-func afternoonColor(now time.Time, events astronomy.Events) Color {
-	return Color{
-		Red:   0,
-		Blue:  255,
-		Green: 0,
-		White: 255,
-		Amber: 0,
-		UV:    255,
-	}
+var morningColor = Color{
+	Red:   0,
+	Blue:  255,
+	Green: 255,
+	White: 0,
+	Amber: 0,
+	UV:    255,
 }
 
-func eveningColor(now time.Time, events astronomy.Events) Color {
-	return Color{
-		Red:   255,
-		Blue:  100,
-		Green: 0,
-		White: 0,
-		Amber: 0,
-		UV:    0,
-	}
+var afternoonColor = Color{
+	Red:   0,
+	Blue:  255,
+	Green: 0,
+	White: 255,
+	Amber: 0,
+	UV:    255,
 }
 
+var eveningColor = Color{
+	Red:   255,
+	Blue:  100,
+	Green: 0,
+	White: 0,
+	Amber: 0,
+	UV:    0,
+}
 
-func nightColor(now time.Time, events astronomy.Events) Color {
-	return Color{
-		Red:   150,
-		Blue:  0,
-		Green: 0,
-		White: 0,
-		Amber: 0,
-		UV:    150,
-	}
+var nightColor = Color{
+	Red:   150,
+	Blue:  0,
+	Green: 0,
+	White: 0,
+	Amber: 0,
+	UV:    150,
 }
 
-//add some smoothing, like average over the last 1000 seconds or something
-func Program(now time.Time, events astronomy.Events) (Color, string) {
-	switch {
-	case timeBefore(now, events.Dawn):
-		return preDawnColor(now, events), "preDawn"
-	case timeBefore(now, events.SunRise):
-		return wakeColor(now, events), "wake"
-	case timeBefore(now, events.SunPeak):
-		return morningColor(now, events), "morning"
-	case timeBefore(now, events.SunSet):
-		return afternoonColor(now, events), "afternoon"
-	case timeBefore(now, events.Dusk):
-		return eveningColor(now, events), "evening"
-	default:
-		return nightColor(now, events), "night"
+//Cues lists the points through each day where the program fades to a new color.  Cues on events that don't happen
+//that day, like dusk in a high latitude summer, are left out.
+func Cues(days []astronomy.Day) []Cue {
+	cues := []Cue{}
+	add := func(name string, at time.Time, color Color, fade time.Duration, easing Easing) {
+		if !at.IsZero() {
+			cues = append(cues, Cue{Name: name, At: at, Color: color, Fade: fade, Easing: easing})
+		}
+	}
+	for _, day := range days {
+		events := day.Events
+		add("preDawn", day.Date, preDawnColor, phaseFade, Perceptual)
+		if !events.Dawn.IsZero() {
+			add("preDawn", events.Dawn.Add(-dawnRamp), dawnColor, dawnRamp, Perceptual)
+		}
+		add("wake", events.Dawn, wakeColor, phaseFade, EaseInOut)
+		add("morning", events.SunRise, morningColor, phaseFade, EaseInOut)
+		add("afternoon", events.SunPeak, afternoonColor, phaseFade, EaseInOut)
+		add("evening", events.SunSet, eveningColor, phaseFade, EaseInOut)
+		add("night", events.Dusk, nightColor, phaseFade, Perceptual)
 	}
-}	
+	return cues
+}
 
-func timeBefore(a time.Time, b time.Time) bool {
-	return localSeconds(a) < localSeconds(b)
+//Program returns the color the lights should be at now, and the name of the phase of the day
+func Program(now time.Time, days []astronomy.Day) (Color, string) {
+	return Evaluate(now, Cues(days))
 }
 
-func localSeconds(a time.Time) int {
-	a = a.Local()
-	return (a.Hour() * 3600) + (a.Minute() * 60) + a.Second()
-}
\ No newline at end of file
+//ClockOn returns the wall clock time that is clock after midnight on the calendar day of date, in date's location.
+//A time skipped when the clocks go forward lands as long after midnight as it would have without the change.
+func ClockOn(date time.Time, clock time.Duration) time.Time {
+	hours, minutes := int(clock/time.Hour), int(clock%time.Hour/time.Minute)
+	t := time.Date(date.Year(), date.Month(), date.Day(), hours, minutes, 0, 0, date.Location())
+	if t.Hour() != hours || t.Minute() != minutes {
+		return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location()).Add(clock)
+	}
+	return t
+}
@@ -0,0 +1,13 @@
+package default_loop_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDefaultLoop(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DefaultLoop Suite")
+}
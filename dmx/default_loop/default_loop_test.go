@@ -0,0 +1,166 @@
+package default_loop_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/rltvty/go-home/dmx/astronomy"
+	. "github.com/rltvty/go-home/dmx/default_loop"
+)
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+//phaseAt runs the program at now, with the calculator's events around now
+func phaseAt(calculator *astronomy.Calculator, now time.Time) string {
+	days, err := astronomy.DaysAround(now, calculator.GetEventsFor)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	_, name := Program(now, days)
+	return name
+}
+
+var _ = Describe("Program", func() {
+	Context("on DST change days in Austin", func() {
+		chicago := mustLoadLocation("America/Chicago")
+		calculator := astronomy.NewCalculator(func(c *astronomy.Calculator) {
+			c.Location = chicago
+		})
+
+		//civil dawn is 07:23 CDT and sunrise 07:47 CDT on 2019-03-10, an hour later on the clock than the day before
+		It("should follow the events when the clocks go forward", func() {
+			Expect(phaseAt(calculator, time.Date(2019, 3, 10, 6, 30, 0, 0, chicago))).To(Equal("preDawn"))
+			Expect(phaseAt(calculator, time.Date(2019, 3, 10, 7, 30, 0, 0, chicago))).To(Equal("wake"))
+			Expect(phaseAt(calculator, time.Date(2019, 3, 10, 7, 50, 0, 0, chicago))).To(Equal("morning"))
+		})
+
+		//civil dawn is 06:22 CST and sunrise 06:47 CST on 2019-11-03
+		It("should follow the events when the clocks go back", func() {
+			Expect(phaseAt(calculator, time.Date(2019, 11, 3, 6, 30, 0, 0, chicago))).To(Equal("wake"))
+			Expect(phaseAt(calculator, time.Date(2019, 11, 3, 6, 50, 0, 0, chicago))).To(Equal("morning"))
+			Expect(phaseAt(calculator, time.Date(2019, 11, 3, 18, 10, 0, 0, chicago))).To(Equal("night"))
+		})
+
+		It("should ramp the whole hour before dawn when the clocks go forward", func() {
+			days, _ := astronomy.DaysAround(time.Date(2019, 3, 10, 12, 0, 0, 0, chicago), calculator.GetEventsFor)
+			dawn := days[1].Events.Dawn
+			start, _ := Program(dawn.Add(-time.Hour), days)
+			middle, _ := Program(dawn.Add(-30*time.Minute), days)
+			end, _ := Program(dawn, days)
+			Expect(start).To(Equal(Color{Red: 10}))
+			Expect(middle.Red).To(BeNumerically(">", 10))
+			Expect(middle.Red).To(BeNumerically("<", 110))
+			Expect(end).To(Equal(Color{Red: 110}))
+		})
+	})
+
+	Context("in the arctic", func() {
+		oslo := mustLoadLocation("Europe/Oslo")
+		tromso := astronomy.NewCalculator(func(c *astronomy.Calculator) {
+			c.Latitude = 69.65
+			c.Longitude = 18.96
+			c.Location = oslo
+		})
+
+		It("should skip the phases that don't happen during the midnight sun", func() {
+			Expect(phaseAt(tromso, time.Date(2019, 6, 21, 0, 30, 0, 0, oslo))).To(Equal("preDawn"))
+			//solar noon is 12:45
+			Expect(phaseAt(tromso, time.Date(2019, 6, 21, 12, 30, 0, 0, oslo))).To(Equal("preDawn"))
+			Expect(phaseAt(tromso, time.Date(2019, 6, 21, 13, 0, 0, 0, oslo))).To(Equal("afternoon"))
+			Expect(phaseAt(tromso, time.Date(2019, 6, 21, 23, 30, 0, 0, oslo))).To(Equal("afternoon"))
+		})
+
+		It("should skip sunrise and sunset during the polar night", func() {
+			//civil dawn is 09:31, noon 11:42 and civil dusk 13:53
+			Expect(phaseAt(tromso, time.Date(2019, 12, 21, 9, 0, 0, 0, oslo))).To(Equal("preDawn"))
+			Expect(phaseAt(tromso, time.Date(2019, 12, 21, 10, 0, 0, 0, oslo))).To(Equal("wake"))
+			Expect(phaseAt(tromso, time.Date(2019, 12, 21, 12, 0, 0, 0, oslo))).To(Equal("afternoon"))
+			Expect(phaseAt(tromso, time.Date(2019, 12, 21, 14, 0, 0, 0, oslo))).To(Equal("night"))
+			Expect(phaseAt(tromso, time.Date(2019, 12, 21, 23, 59, 0, 0, oslo))).To(Equal("night"))
+		})
+	})
+})
+
+//boundaryDays are three days with the same made up events, so each phase starts at a round time
+func boundaryDays() []astronomy.Day {
+	days := []astronomy.Day{}
+	for offset := -1; offset <= 1; offset++ {
+		date := time.Date(2019, 6, 21+offset, 0, 0, 0, 0, time.UTC)
+		at := func(hour, minute int) time.Time {
+			return date.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+		}
+		days = append(days, astronomy.Day{Date: date, Events: astronomy.Events{
+			Dawn:    at(5, 0),
+			SunRise: at(5, 30),
+			SunPeak: at(12, 0),
+			SunSet:  at(19, 0),
+			Dusk:    at(19, 30),
+		}})
+	}
+	return days
+}
+
+var _ = Describe("Program phase boundaries", func() {
+	days := boundaryDays()
+	at := func(clock string) time.Time {
+		t, err := time.Parse("15:04:05", clock)
+		Expect(err).NotTo(HaveOccurred())
+		return time.Date(2019, 6, 21, t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	}
+
+	DescribeTable("the phase either side of each cue",
+		func(clock string, phase string) {
+			_, name := Program(at(clock), days)
+			Expect(name).To(Equal(phase))
+		},
+		Entry("midnight", "00:00:00", "preDawn"),
+		Entry("before the dawn ramp", "03:59:59", "preDawn"),
+		Entry("the dawn ramp", "04:00:00", "preDawn"),
+		Entry("before dawn", "04:59:59", "preDawn"),
+		Entry("dawn", "05:00:00", "wake"),
+		Entry("before sunrise", "05:29:59", "wake"),
+		Entry("sunrise", "05:30:00", "morning"),
+		Entry("before solar noon", "11:59:59", "morning"),
+		Entry("solar noon", "12:00:00", "afternoon"),
+		Entry("before sunset", "18:59:59", "afternoon"),
+		Entry("sunset", "19:00:00", "evening"),
+		Entry("before dusk", "19:29:59", "evening"),
+		Entry("dusk", "19:30:00", "night"),
+		Entry("before midnight", "23:59:59", "night"),
+	)
+
+	DescribeTable("the color at and after each cue",
+		func(clock string, color Color) {
+			actual, _ := Program(at(clock), days)
+			Expect(actual).To(Equal(color))
+		},
+		Entry("midnight starts fading from night", "00:00:00", Color{Red: 150, UV: 150}),
+		Entry("pre-dawn once faded", "00:15:00", Color{Red: 10}),
+		Entry("the dawn ramp starts at pre-dawn", "04:00:00", Color{Red: 10}),
+		Entry("dawn starts at the end of the ramp", "05:00:00", Color{Red: 110}),
+		Entry("wake once faded", "05:15:00", Color{Blue: 100, Green: 100, UV: 255}),
+		Entry("morning once faded", "05:45:00", Color{Blue: 255, Green: 255, UV: 255}),
+		Entry("afternoon once faded", "12:15:00", Color{Blue: 255, White: 255, UV: 255}),
+		Entry("evening once faded", "19:15:00", Color{Red: 255, Blue: 100}),
+		Entry("night once faded", "19:45:00", Color{Red: 150, UV: 150}),
+	)
+})
+
+var _ = Describe("ClockOn", func() {
+	chicago := mustLoadLocation("America/Chicago")
+
+	It("should give the wall clock time", func() {
+		Expect(ClockOn(time.Date(2019, 3, 10, 12, 0, 0, 0, chicago), 22*time.Hour+30*time.Minute)).To(Equal(time.Date(2019, 3, 10, 22, 30, 0, 0, chicago)))
+	})
+
+	It("should move times in the skipped hour forward", func() {
+		Expect(ClockOn(time.Date(2019, 3, 10, 12, 0, 0, 0, chicago), 2*time.Hour+30*time.Minute)).To(Equal(time.Date(2019, 3, 10, 3, 30, 0, 0, chicago)))
+	})
+})
@@ -0,0 +1,152 @@
+package default_loop
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+//Easing is the curve a fade follows from one color to the next
+type Easing string
+
+const (
+	Linear    Easing = "linear"
+	EaseInOut Easing = "ease-in-out"
+	//Perceptual fades evenly in CIE lightness, so the dim end of a fade doesn't jump
+	Perceptual Easing = "perceptual"
+)
+
+//ParseEasing checks that name is a known easing, an empty name is Linear
+func ParseEasing(name string) (Easing, error) {
+	switch Easing(name) {
+	case "":
+		return Linear, nil
+	case Linear, EaseInOut, Perceptual:
+		return Easing(name), nil
+	default:
+		return "", fmt.Errorf("Unknown easing: %s", name)
+	}
+}
+
+//Cue is a point in time where a program starts fading to a new color
+type Cue struct {
+	Name   string
+	At     time.Time
+	Color  Color
+	Fade   time.Duration
+	Easing Easing
+}
+
+//Transition is a fade between two colors over a fixed window of wall clock time
+type Transition struct {
+	From     Color
+	To       Color
+	Start    time.Time
+	Duration time.Duration
+	Easing   Easing
+}
+
+//At returns the color of the transition at now, before Start it is From and after the end it is To
+func (t Transition) At(now time.Time) Color {
+	if t.Duration <= 0 || !now.Before(t.Start.Add(t.Duration)) {
+		return t.To
+	}
+	if now.Before(t.Start) {
+		return t.From
+	}
+	progress := float64(now.Sub(t.Start)) / float64(t.Duration)
+	return Interpolate(t.From, t.To, progress, t.Easing)
+}
+
+//Interpolate returns the color progress of the way (0 to 1) from one color to another
+func Interpolate(from Color, to Color, progress float64, easing Easing) Color {
+	progress = math.Max(0, math.Min(1, progress))
+	mix := func(a byte, b byte) byte {
+		switch easing {
+		case EaseInOut:
+			p := (1 - math.Cos(math.Pi*progress)) / 2
+			return roundByte(float64(a) + (float64(b)-float64(a))*p)
+		case Perceptual:
+			la, lb := lightness(a), lightness(b)
+			return fromLightness(la + (lb-la)*progress)
+		default:
+			return roundByte(float64(a) + (float64(b)-float64(a))*progress)
+		}
+	}
+	return Color{
+		Red:   mix(from.Red, to.Red),
+		Blue:  mix(from.Blue, to.Blue),
+		Green: mix(from.Green, to.Green),
+		White: mix(from.White, to.White),
+		Amber: mix(from.Amber, to.Amber),
+		UV:    mix(from.UV, to.UV),
+	}
+}
+
+//Scale dims every channel of a color by level, 0 to 1
+func Scale(color Color, level float64) Color {
+	return Interpolate(Color{}, color, level, Linear)
+}
+
+//lightness converts a channel level to CIE L* (0-100), treating the level as relative luminance
+func lightness(level byte) float64 {
+	y := float64(level) / 255
+	if y <= 216.0/24389 {
+		return y * 24389 / 27
+	}
+	return 116*math.Cbrt(y) - 16
+}
+
+func fromLightness(l float64) byte {
+	var y float64
+	if l <= 8 {
+		y = l * 27 / 24389
+	} else {
+		y = math.Pow((l+16)/116, 3)
+	}
+	return roundByte(y * 255)
+}
+
+func roundByte(level float64) byte {
+	return byte(math.Max(0, math.Min(255, math.Round(level))))
+}
+
+//Evaluate returns the color and name of the active cue at now, partway through its fade if it is still running.
+//Each fade starts from whatever color was showing when the cue was reached, so it only depends on the clock.
+func Evaluate(now time.Time, cues []Cue) (Color, string) {
+	sorted := append([]Cue{}, cues...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].At.Before(sorted[j].At)
+	})
+	return evaluate(now, sorted)
+}
+
+func evaluate(now time.Time, cues []Cue) (Color, string) {
+	active := -1
+	for i, cue := range cues {
+		if cue.At.After(now) {
+			break
+		}
+		active = i
+	}
+	switch active {
+	case -1:
+		if len(cues) == 0 {
+			return Color{}, ""
+		}
+		return cues[0].Color, cues[0].Name
+	case 0:
+		return cues[0].Color, cues[0].Name
+	}
+
+	cue := cues[active]
+	from, _ := evaluate(cue.At, cues[:active])
+	return Transition{
+		From:     from,
+		To:       cue.Color,
+		Start:    cue.At,
+		Duration: cue.Fade,
+		Easing:   cue.Easing,
+	}.At(now), cue.Name
+}
@@ -0,0 +1,96 @@
+package default_loop_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/rltvty/go-home/dmx/default_loop"
+)
+
+var _ = Describe("Fade", func() {
+	start := time.Date(2019, 6, 1, 6, 0, 0, 0, time.UTC)
+	black := Color{}
+	red := Color{Red: 200}
+
+	Describe("Interpolate", func() {
+		It("should mix linearly", func() {
+			Expect(Interpolate(black, red, 0.25, Linear)).To(Equal(Color{Red: 50}))
+		})
+
+		It("should ease in and out", func() {
+			Expect(Interpolate(black, red, 0.25, EaseInOut)).To(Equal(Color{Red: 29}))
+			Expect(Interpolate(black, red, 0.5, EaseInOut)).To(Equal(Color{Red: 100}))
+		})
+
+		It("should fade perceptually, spending longer at the dim end", func() {
+			Expect(Interpolate(black, red, 0.25, Perceptual)).To(Equal(Color{Red: 10}))
+			Expect(Interpolate(black, red, 0.5, Perceptual)).To(Equal(Color{Red: 38}))
+			Expect(Interpolate(black, red, 1, Perceptual)).To(Equal(red))
+		})
+
+		It("should clamp progress", func() {
+			Expect(Interpolate(black, red, -1, Linear)).To(Equal(black))
+			Expect(Interpolate(black, red, 2, Linear)).To(Equal(red))
+		})
+	})
+
+	Describe("Scale", func() {
+		It("should dim every channel", func() {
+			Expect(Scale(Color{Red: 200, UV: 100}, 0.1)).To(Equal(Color{Red: 20, UV: 10}))
+		})
+	})
+
+	Describe("ParseEasing", func() {
+		It("should default to linear", func() {
+			Expect(ParseEasing("")).To(Equal(Linear))
+		})
+
+		It("should reject unknown easings", func() {
+			_, err := ParseEasing("bouncy")
+			Expect(err).To(MatchError("Unknown easing: bouncy"))
+		})
+	})
+
+	Describe("Transition", func() {
+		transition := Transition{From: black, To: red, Start: start, Duration: 10 * time.Minute, Easing: Linear}
+
+		It("should follow the wall clock", func() {
+			Expect(transition.At(start.Add(-time.Minute))).To(Equal(black))
+			Expect(transition.At(start.Add(5 * time.Minute))).To(Equal(Color{Red: 100}))
+			Expect(transition.At(start.Add(10 * time.Minute))).To(Equal(red))
+		})
+	})
+
+	Describe("Evaluate", func() {
+		cues := []Cue{
+			{Name: "blue", At: start.Add(time.Hour), Color: Color{Blue: 200}, Fade: 20 * time.Minute, Easing: Linear},
+			{Name: "red", At: start, Color: red, Fade: 0, Easing: Linear},
+			{Name: "black", At: start.Add(time.Hour + 10*time.Minute), Color: black, Fade: 10 * time.Minute, Easing: Linear},
+		}
+
+		It("should show the first cue before any have started", func() {
+			color, name := Evaluate(start.Add(-time.Hour), cues)
+			Expect(name).To(Equal("red"))
+			Expect(color).To(Equal(red))
+		})
+
+		It("should fade from the previous cue", func() {
+			color, name := Evaluate(start.Add(time.Hour+5*time.Minute), cues)
+			Expect(name).To(Equal("blue"))
+			Expect(color).To(Equal(Color{Red: 150, Blue: 50}))
+		})
+
+		It("should start a fade from the middle of an unfinished one", func() {
+			color, name := Evaluate(start.Add(time.Hour+15*time.Minute), cues)
+			Expect(name).To(Equal("black"))
+			Expect(color).To(Equal(Color{Red: 50, Blue: 50}))
+		})
+
+		It("should hold the last cue once its fade finishes", func() {
+			color, _ := Evaluate(start.Add(3*time.Hour), cues)
+			Expect(color).To(Equal(black))
+		})
+	})
+})
@@ -0,0 +1,172 @@
+package discovery
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jsimonetti/go-artnet/packet"
+	"github.com/rltvty/go-home/logwrapper"
+	"go.uber.org/zap"
+)
+
+const defaultPollInterval = 3 * time.Second
+
+//a node that misses this many polls in a row is dropped from the registry
+const missedPollLimit = 3
+
+//Node is an Art-Net node that has answered an ArtPoll
+type Node struct {
+	IP        string    `json:"ip"`
+	MAC       string    `json:"mac"`
+	ShortName string    `json:"shortName"`
+	LongName  string    `json:"longName"`
+	Report    string    `json:"report"`
+	Firmware  uint16    `json:"firmware"`
+	BindIndex uint8     `json:"bindIndex"`
+	Ports     int       `json:"ports"`
+	Inputs    []uint16  `json:"inputUniverses"`
+	Outputs   []uint16  `json:"outputUniverses"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+//Registry tracks the nodes seen on the network
+type Registry struct {
+	PollInterval time.Duration
+	mu           sync.Mutex
+	nodes        map[string]Node
+}
+
+//NewRegistry creates an empty registry with optional options
+func NewRegistry(options ...func(*Registry)) *Registry {
+	registry := Registry{
+		PollInterval: defaultPollInterval,
+		nodes:        map[string]Node{},
+	}
+	registry.SetOptions(options...)
+
+	return &registry
+}
+
+// SetOptions takes one or more option function and applies them in order to Registry.
+func (r *Registry) SetOptions(options ...func(*Registry)) {
+	for _, opt := range options {
+		opt(r)
+	}
+}
+
+//NodeFromReply decodes an ArtPollReply into a Node
+func NodeFromReply(reply *packet.ArtPollReplyPacket, seen time.Time) Node {
+	ports := int(reply.NumPorts & 0xFF)
+	if ports > len(reply.SwOut) {
+		ports = len(reply.SwOut)
+	}
+
+	//the 15 bit Port-Address is Net (7 bits), Sub-Net (4 bits) and Universe (4 bits)
+	base := uint16(reply.NetSwitch&0x7F)<<8 | uint16(reply.SubSwitch&0x0F)<<4
+	inputs := make([]uint16, 0, ports)
+	outputs := make([]uint16, 0, ports)
+	for i := 0; i < ports; i++ {
+		inputs = append(inputs, base|uint16(reply.SwIn[i]&0x0F))
+		outputs = append(outputs, base|uint16(reply.SwOut[i]&0x0F))
+	}
+
+	return Node{
+		IP:        net.IP(reply.IPAddress[:]).String(),
+		MAC:       net.HardwareAddr(reply.Macaddress[:]).String(),
+		ShortName: cString(reply.ShortName[:]),
+		LongName:  cString(reply.LongName[:]),
+		Report:    cString(reply.NodeReport[:]),
+		Firmware:  reply.VersionInfo,
+		BindIndex: reply.BindIndex,
+		Ports:     ports,
+		Inputs:    inputs,
+		Outputs:   outputs,
+		LastSeen:  seen,
+	}
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(bytes.TrimSpace(b))
+}
+
+//Update records a node, replacing any earlier reply from the same IP and bind index
+func (r *Registry) Update(node Node) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nodes[node.key()] = node
+}
+
+func (n Node) key() string {
+	return fmt.Sprintf("%s/%d", n.IP, n.BindIndex)
+}
+
+//Nodes lists the nodes that have replied recently, ordered by IP
+func (r *Registry) Nodes(now time.Time) []Node {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nodes := make([]Node, 0, len(r.nodes))
+	for key, node := range r.nodes {
+		if now.Sub(node.LastSeen) > missedPollLimit*r.PollInterval {
+			delete(r.nodes, key)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].IP == nodes[j].IP {
+			return nodes[i].key() < nodes[j].key()
+		}
+		return bytes.Compare(net.ParseIP(nodes[i].IP), net.ParseIP(nodes[j].IP)) < 0
+	})
+	return nodes
+}
+
+//HandlePacket records the packet if it is an ArtPollReply, returning whether it was one
+func (r *Registry) HandlePacket(b []byte, now time.Time) bool {
+	p, err := packet.Unmarshal(b)
+	if err != nil {
+		return false
+	}
+	reply, ok := p.(*packet.ArtPollReplyPacket)
+	if !ok {
+		return false
+	}
+	node := NodeFromReply(reply, now)
+	logwrapper.GetInstance().Debug("Got ArtPollReply", zap.String("ip", node.IP), zap.String("name", node.ShortName))
+	r.Update(node)
+	return true
+}
+
+//Poll broadcasts an ArtPoll every PollInterval until quit receives
+func (r *Registry) Poll(conn net.PacketConn, broadcast net.IP, quit chan int) {
+	log := logwrapper.GetInstance()
+	addr := &net.UDPAddr{IP: broadcast, Port: packet.ArtNetPort}
+
+	b, err := packet.NewArtPollPacket().MarshalBinary()
+	if err != nil {
+		log.InfoError("Unable to marshal ArtPoll", err)
+		return
+	}
+
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := conn.WriteTo(b, addr); err != nil {
+			log.InfoError("Unable to send ArtPoll", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-quit:
+			log.Info("Poll received quit request, exiting...")
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package discovery_test
+
+import (
+	"time"
+
+	"github.com/jsimonetti/go-artnet/packet"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/rltvty/go-home/dmx/discovery"
+)
+
+func replyHelper(ip [4]byte, name string) *packet.ArtPollReplyPacket {
+	reply := packet.NewArtPollReplyPacket()
+	reply.IPAddress = ip
+	copy(reply.ShortName[:], name)
+	copy(reply.LongName[:], name+" long name")
+	reply.VersionInfo = 0x0102
+	reply.NetSwitch = 0x01
+	reply.SubSwitch = 0x02
+	reply.NumPorts = 2
+	reply.SwIn = [4]uint8{0, 1, 0, 0}
+	reply.SwOut = [4]uint8{3, 4, 0, 0}
+	reply.Macaddress = [6]byte{0, 0x0A, 0x92, 0xC8, 0x0B, 0xEF}
+	return reply
+}
+
+var _ = Describe("Discovery", func() {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	Describe("NodeFromReply", func() {
+		It("should decode names, firmware and port addresses", func() {
+			node := NodeFromReply(replyHelper([4]byte{10, 10, 10, 20}, "sink"), now)
+			Expect(node).To(Equal(Node{
+				IP:        "10.10.10.20",
+				MAC:       "00:0a:92:c8:0b:ef",
+				ShortName: "sink",
+				LongName:  "sink long name",
+				Report:    "",
+				Firmware:  0x0102,
+				Ports:     2,
+				Inputs:    []uint16{0x0120, 0x0121},
+				Outputs:   []uint16{0x0123, 0x0124},
+				LastSeen:  now,
+			}))
+		})
+	})
+
+	Describe("Registry", func() {
+		var registry *Registry
+
+		BeforeEach(func() {
+			registry = NewRegistry(func(r *Registry) {
+				r.PollInterval = time.Second
+			})
+		})
+
+		It("should list nodes ordered by ip", func() {
+			registry.Update(NodeFromReply(replyHelper([4]byte{10, 10, 10, 21}, "shower"), now))
+			registry.Update(NodeFromReply(replyHelper([4]byte{10, 10, 10, 3}, "hall"), now))
+			nodes := registry.Nodes(now)
+			Expect(nodes).To(HaveLen(2))
+			Expect(nodes[0].ShortName).To(Equal("hall"))
+			Expect(nodes[1].ShortName).To(Equal("shower"))
+		})
+
+		It("should replace earlier replies from the same node", func() {
+			registry.Update(NodeFromReply(replyHelper([4]byte{10, 10, 10, 20}, "old"), now))
+			registry.Update(NodeFromReply(replyHelper([4]byte{10, 10, 10, 20}, "new"), now.Add(time.Second)))
+			nodes := registry.Nodes(now.Add(time.Second))
+			Expect(nodes).To(HaveLen(1))
+			Expect(nodes[0].ShortName).To(Equal("new"))
+		})
+
+		It("should drop nodes that stop replying", func() {
+			registry.Update(NodeFromReply(replyHelper([4]byte{10, 10, 10, 20}, "sink"), now))
+			Expect(registry.Nodes(now.Add(3 * time.Second))).To(HaveLen(1))
+			Expect(registry.Nodes(now.Add(4 * time.Second))).To(BeEmpty())
+		})
+
+		It("should ignore packets that aren't ArtPollReplies", func() {
+			Expect(registry.HandlePacket([]byte("not art-net"), now)).To(BeFalse())
+			Expect(registry.Nodes(now)).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,207 @@
+package effect
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rltvty/go-home/dmx/default_loop"
+)
+
+//Kind names an effect
+type Kind string
+
+const (
+	//Breathe slowly dims and brightens
+	Breathe Kind = "breathe"
+	//Candle flickers like a flame
+	Candle Kind = "candle"
+	//Cycle rotates through the hues
+	Cycle Kind = "cycle"
+	//Chase moves a spot of light across the fixtures it runs on
+	Chase Kind = "chase"
+	//Strobe flashes, for alerts
+	Strobe Kind = "strobe"
+)
+
+//Blend is how an effect's color is combined with the color underneath it
+type Blend string
+
+const (
+	//Replace shows only the effect's color
+	Replace Blend = "replace"
+	//Multiply dims the color underneath by the effect's color
+	Multiply Blend = "multiply"
+	//Add adds the effect's color to the color underneath
+	Add Blend = "add"
+	//Max takes the brighter of the two on each channel
+	Max Blend = "max"
+)
+
+//Effect is a parameterised animation layered on top of the program color
+type Effect struct {
+	Kind Kind
+	//Color is the effect's color, nil uses the color underneath
+	Color *default_loop.Color
+	//Period is the length of one breath, color cycle, chase lap or strobe flash, or the flicker speed of a candle
+	Period time.Duration
+	//Depth (0-1) is how far breathing and flicker dim the color
+	Depth float64
+	//Level (0-1) is the brightness of a color cycle
+	Level float64
+	Blend Blend
+	//Start is when the effect was triggered, animations start from here
+	Start time.Time
+}
+
+//EffectJSON intermediate type for parsing an effect, fields left out take the kind's defaults
+type EffectJSON struct {
+	Kind   string              `json:"kind"`
+	Color  *default_loop.Color `json:"color"`
+	Period string              `json:"period"`
+	Depth  *float64            `json:"depth"`
+	Level  *float64            `json:"level"`
+	Blend  string              `json:"blend"`
+}
+
+var defaults = map[Kind]Effect{
+	Breathe: {Kind: Breathe, Period: 4 * time.Second, Depth: 0.7, Blend: Replace},
+	Candle:  {Kind: Candle, Period: 120 * time.Millisecond, Depth: 0.4, Blend: Replace, Color: &candleColor},
+	Cycle:   {Kind: Cycle, Period: time.Minute, Level: 1, Blend: Replace},
+	Chase:   {Kind: Chase, Period: 2 * time.Second, Blend: Max, Color: &chaseColor},
+	Strobe:  {Kind: Strobe, Period: 200 * time.Millisecond, Blend: Replace, Color: &strobeColor},
+}
+
+var candleColor = default_loop.Kelvin(1800, 0.6)
+var chaseColor = default_loop.Kelvin(4000, 1)
+var strobeColor = default_loop.Color{Red: 255, Green: 255, Blue: 255, White: 255}
+
+//strobeDuty is the part of each strobe period the light is on
+const strobeDuty = 0.25
+
+//Parse builds an effect from its definition, filling in the kind's defaults
+func Parse(definition EffectJSON) (*Effect, error) {
+	effect, ok := defaults[Kind(definition.Kind)]
+	if !ok {
+		return nil, fmt.Errorf("Unknown effect: %s", definition.Kind)
+	}
+	if definition.Color != nil {
+		effect.Color = definition.Color
+	}
+	if definition.Period != "" {
+		period, err := time.ParseDuration(definition.Period)
+		if err != nil || period <= 0 {
+			return nil, fmt.Errorf("Invalid period: %s", definition.Period)
+		}
+		effect.Period = period
+	}
+	if definition.Depth != nil {
+		if *definition.Depth < 0 || *definition.Depth > 1 {
+			return nil, errors.New("Depth must be between 0 and 1")
+		}
+		effect.Depth = *definition.Depth
+	}
+	if definition.Level != nil {
+		if *definition.Level < 0 || *definition.Level > 1 {
+			return nil, errors.New("Level must be between 0 and 1")
+		}
+		effect.Level = *definition.Level
+	}
+	switch Blend(definition.Blend) {
+	case "":
+	case Replace, Multiply, Add, Max:
+		effect.Blend = Blend(definition.Blend)
+	default:
+		return nil, fmt.Errorf("Unknown blend: %s", definition.Blend)
+	}
+	return &effect, nil
+}
+
+//Render returns the color of a fixture at now with the effect blended over base.  Index and count are the
+//fixture's position among the fixtures the effect runs on, which the chase moves across.
+func (e Effect) Render(base default_loop.Color, now time.Time, index int, count int) default_loop.Color {
+	return e.Blend.Mix(base, e.layer(base, now, index, count))
+}
+
+//layer is the effect's own color at now
+func (e Effect) layer(base default_loop.Color, now time.Time, index int, count int) default_loop.Color {
+	color := base
+	if e.Color != nil {
+		color = *e.Color
+	}
+	elapsed := now.Sub(e.Start).Seconds()
+	cycles := elapsed / e.Period.Seconds()
+
+	switch e.Kind {
+	case Breathe:
+		//starts at full and reaches the bottom halfway through each breath
+		return default_loop.Scale(color, 1-e.Depth*(0.5-0.5*math.Cos(2*math.Pi*cycles)))
+	case Candle:
+		return default_loop.Scale(color, 1-e.Depth*flicker(cycles, index))
+	case Cycle:
+		return default_loop.HSV(360*cycles, 1, e.Level)
+	case Chase:
+		if count < 1 {
+			return default_loop.Color{}
+		}
+		//the spot goes round the fixtures once per period, lighting neighbours as it passes between them
+		position := math.Mod(cycles, 1) * float64(count)
+		distance := math.Abs(position - float64(index))
+		distance = math.Min(distance, float64(count)-distance)
+		return default_loop.Scale(color, math.Max(0, 1-distance))
+	case Strobe:
+		if math.Mod(cycles, 1) < strobeDuty {
+			return color
+		}
+		return default_loop.Color{}
+	}
+	return color
+}
+
+//flicker is smooth random noise between 0 and 1, a new random value each cycle, different for each fixture
+func flicker(cycles float64, index int) float64 {
+	step := math.Floor(cycles)
+	fraction := cycles - step
+	fraction = fraction * fraction * (3 - 2*fraction)
+	from := random(uint64(int64(step)), index)
+	to := random(uint64(int64(step)+1), index)
+	return from + (to-from)*fraction
+}
+
+//random hashes the step and index into a number between 0 and 1, with splitmix64
+func random(step uint64, index int) float64 {
+	z := step*0x9E3779B97F4A7C15 + uint64(index)*0xBF58476D1CE4E5B9 + 0x94D049BB133111EB
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	z = z ^ (z >> 31)
+	return float64(z>>11) / float64(1<<53)
+}
+
+//Mix combines the effect's color with the color underneath
+func (b Blend) Mix(base default_loop.Color, layer default_loop.Color) default_loop.Color {
+	var mix func(base byte, layer byte) byte
+	switch b {
+	case Multiply:
+		mix = func(base byte, layer byte) byte { return byte((int(base)*int(layer) + 127) / 255) }
+	case Add:
+		mix = func(base byte, layer byte) byte { return byte(math.Min(255, float64(base)+float64(layer))) }
+	case Max:
+		mix = func(base byte, layer byte) byte {
+			if layer > base {
+				return layer
+			}
+			return base
+		}
+	default:
+		return layer
+	}
+	return default_loop.Color{
+		Red:   mix(base.Red, layer.Red),
+		Green: mix(base.Green, layer.Green),
+		Blue:  mix(base.Blue, layer.Blue),
+		White: mix(base.White, layer.White),
+		Amber: mix(base.Amber, layer.Amber),
+		UV:    mix(base.UV, layer.UV),
+	}
+}
@@ -0,0 +1,123 @@
+package effect_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/rltvty/go-home/dmx/default_loop"
+	. "github.com/rltvty/go-home/dmx/effect"
+)
+
+var _ = Describe("Effect", func() {
+	start := time.Date(2019, 6, 1, 20, 0, 0, 0, time.UTC)
+	base := default_loop.Color{Red: 200, Amber: 100}
+
+	parse := func(definition EffectJSON) Effect {
+		e, err := Parse(definition)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		e.Start = start
+		return *e
+	}
+
+	Describe("Parse", func() {
+		It("should fill in the defaults", func() {
+			e := parse(EffectJSON{Kind: "breathe"})
+			Expect(e.Period).To(Equal(4 * time.Second))
+			Expect(e.Depth).To(Equal(0.7))
+			Expect(e.Blend).To(Equal(Replace))
+		})
+
+		It("should take parameters", func() {
+			depth := 0.2
+			e := parse(EffectJSON{Kind: "breathe", Period: "10s", Depth: &depth, Blend: "multiply"})
+			Expect(e.Period).To(Equal(10 * time.Second))
+			Expect(e.Depth).To(Equal(0.2))
+			Expect(e.Blend).To(Equal(Multiply))
+		})
+
+		DescribeTable("rejecting invalid effects",
+			func(definition EffectJSON, message string) {
+				_, err := Parse(definition)
+				Expect(err).To(MatchError(message))
+			},
+			Entry("unknown kind", EffectJSON{Kind: "lasers"}, "Unknown effect: lasers"),
+			Entry("bad period", EffectJSON{Kind: "strobe", Period: "-1s"}, "Invalid period: -1s"),
+			Entry("bad blend", EffectJSON{Kind: "strobe", Blend: "screen"}, "Unknown blend: screen"),
+		)
+	})
+
+	Describe("Breathe", func() {
+		It("should dim to the depth halfway through each breath", func() {
+			e := parse(EffectJSON{Kind: "breathe"})
+			Expect(e.Render(base, start, 0, 1)).To(Equal(base))
+			Expect(e.Render(base, start.Add(2*time.Second), 0, 1)).To(Equal(default_loop.Color{Red: 60, Amber: 30}))
+			Expect(e.Render(base, start.Add(4*time.Second), 0, 1)).To(Equal(base))
+		})
+	})
+
+	Describe("Candle", func() {
+		e := parse(EffectJSON{Kind: "candle"})
+
+		It("should flicker within the depth", func() {
+			seen := map[default_loop.Color]bool{}
+			for i := 0; i < 100; i++ {
+				color := e.Render(base, start.Add(time.Duration(i)*37*time.Millisecond), 0, 1)
+				Expect(color.Amber).To(BeNumerically(">=", float64((*e.Color).Amber)*0.6-1))
+				Expect(color.Amber).To(BeNumerically("<=", (*e.Color).Amber))
+				seen[color] = true
+			}
+			Expect(len(seen)).To(BeNumerically(">", 10))
+		})
+
+		It("should flicker differently on each fixture, but the same each time", func() {
+			at := start.Add(500 * time.Millisecond)
+			Expect(e.Render(base, at, 0, 2)).NotTo(Equal(e.Render(base, at, 1, 2)))
+			Expect(e.Render(base, at, 0, 2)).To(Equal(e.Render(base, at, 0, 2)))
+		})
+	})
+
+	Describe("Cycle", func() {
+		It("should go round the hues once a period", func() {
+			e := parse(EffectJSON{Kind: "cycle"})
+			Expect(e.Render(base, start, 0, 1)).To(Equal(default_loop.HSV(0, 1, 1)))
+			Expect(e.Render(base, start.Add(20*time.Second), 0, 1)).To(Equal(default_loop.HSV(120, 1, 1)))
+			Expect(e.Render(base, start.Add(time.Minute), 0, 1)).To(Equal(default_loop.HSV(0, 1, 1)))
+		})
+	})
+
+	Describe("Chase", func() {
+		It("should move a spot across the fixtures", func() {
+			white := default_loop.Color{White: 255}
+			e := parse(EffectJSON{Kind: "chase", Color: &white, Period: "4s", Blend: "replace"})
+			Expect(e.Render(base, start, 0, 4)).To(Equal(white))
+			Expect(e.Render(base, start, 1, 4)).To(Equal(default_loop.Color{}))
+			Expect(e.Render(base, start.Add(500*time.Millisecond), 0, 4)).To(Equal(default_loop.Color{White: 128}))
+			Expect(e.Render(base, start.Add(500*time.Millisecond), 1, 4)).To(Equal(default_loop.Color{White: 128}))
+			Expect(e.Render(base, start.Add(3*time.Second), 3, 4)).To(Equal(white))
+			//and back round to the first
+			Expect(e.Render(base, start.Add(3500*time.Millisecond), 0, 4)).To(Equal(default_loop.Color{White: 128}))
+		})
+	})
+
+	Describe("Strobe", func() {
+		It("should flash for a quarter of each period", func() {
+			e := parse(EffectJSON{Kind: "strobe"})
+			Expect(e.Render(base, start.Add(10*time.Millisecond), 0, 1).White).To(BeNumerically("==", 255))
+			Expect(e.Render(base, start.Add(100*time.Millisecond), 0, 1)).To(Equal(default_loop.Color{}))
+			Expect(e.Render(base, start.Add(210*time.Millisecond), 0, 1).White).To(BeNumerically("==", 255))
+		})
+	})
+
+	DescribeTable("Blend",
+		func(blend Blend, expected default_loop.Color) {
+			Expect(blend.Mix(default_loop.Color{Red: 200, Green: 100}, default_loop.Color{Red: 100, Blue: 50, Green: 128})).To(Equal(expected))
+		},
+		Entry("replace", Replace, default_loop.Color{Red: 100, Green: 128, Blue: 50}),
+		Entry("multiply", Multiply, default_loop.Color{Red: 78, Green: 50}),
+		Entry("add", Add, default_loop.Color{Red: 255, Green: 228, Blue: 50}),
+		Entry("max", Max, default_loop.Color{Red: 200, Green: 128, Blue: 50}),
+	)
+})
@@ -0,0 +1,45 @@
+package fixture
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/rltvty/go-home/dmx/default_loop"
+)
+
+//LoadCalibrations reads a JSON file of emitter calibrations keyed by fixture name, like
+//{"sink": {"red": {"x": 0.69, "y": 0.31, "luminance": 0.28}, ...}}
+func LoadCalibrations(path string) (map[string]default_loop.Calibration, error) {
+	jsonData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	calibrations := map[string]default_loop.Calibration{}
+	if err := json.Unmarshal(jsonData, &calibrations); err != nil {
+		return nil, err
+	}
+	for name, calibration := range calibrations {
+		if err := calibration.Validate(); err != nil {
+			return nil, fmt.Errorf("Fixture %s: %s", name, err)
+		}
+	}
+	return calibrations, nil
+}
+
+//Calibrate applies the calibrations to the fixtures with the same name, erroring on names that aren't fixtures
+func Calibrate(fixtures []*Fixture, calibrations map[string]default_loop.Calibration) error {
+	known := map[string]*Fixture{}
+	for _, f := range fixtures {
+		known[f.Name] = f
+	}
+	for name, calibration := range calibrations {
+		f, ok := known[name]
+		if !ok {
+			return fmt.Errorf("Calibration for unknown fixture %s", name)
+		}
+		calibration := calibration
+		f.Calibration = &calibration
+	}
+	return nil
+}
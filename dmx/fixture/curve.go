@@ -0,0 +1,135 @@
+package fixture
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+//Curve maps color levels (0-255) to 16 bit output levels, so fixtures whose LEDs respond linearly to the DMX
+//value fade evenly to the eye.  The coarse channel gets the top byte, and a fine channel, if the profile has one,
+//the bottom byte.
+type Curve [256]uint16
+
+//LinearCurve sends color levels straight through, as the output did before curves
+func LinearCurve() *Curve {
+	return curveFrom(func(level float64) float64 { return level })
+}
+
+//GammaCurve raises the level to gamma, 2.2 is typical
+func GammaCurve(gamma float64) *Curve {
+	return curveFrom(func(level float64) float64 { return math.Pow(level, gamma) })
+}
+
+//CIECurve treats the level as CIE 1931 lightness (L*), the closest match to how bright the eye sees the light
+func CIECurve() *Curve {
+	return curveFrom(func(level float64) float64 {
+		lightness := level * 100
+		if lightness <= 8 {
+			return lightness / 903.3
+		}
+		return math.Pow((lightness+16)/116, 3)
+	})
+}
+
+//LUTCurve interpolates a custom table of output levels, spread evenly over the color levels 0-255
+func LUTCurve(points []uint16) (*Curve, error) {
+	if len(points) < 2 {
+		return nil, errors.New("A LUT needs at least 2 points")
+	}
+	return curveFrom(func(level float64) float64 {
+		position := level * float64(len(points)-1)
+		i := int(math.Min(position, float64(len(points)-2)))
+		fraction := position - float64(i)
+		return (float64(points[i])*(1-fraction) + float64(points[i+1])*fraction) / 65535
+	}), nil
+}
+
+//curveFrom builds a curve from f, taking and returning levels between 0 and 1
+func curveFrom(f func(level float64) float64) *Curve {
+	var curve Curve
+	for i := range curve {
+		curve[i] = uint16(math.Max(0, math.Min(65535, math.Round(f(float64(i)/255)*65535))))
+	}
+	return &curve
+}
+
+//At returns the output level for a color level, interpolating between table entries for fractional levels
+func (c *Curve) At(level float64) uint16 {
+	switch {
+	case level <= 0:
+		return c[0]
+	case level >= 255:
+		return c[255]
+	}
+	i := int(level)
+	fraction := level - float64(i)
+	return uint16(math.Round(float64(c[i])*(1-fraction) + float64(c[i+1])*fraction))
+}
+
+//CurveJSON intermediate type for parsing a curve
+type CurveJSON struct {
+	//Type is one of linear, gamma, cie or lut
+	Type  string   `json:"type"`
+	Gamma float64  `json:"gamma"`
+	LUT   []uint16 `json:"lut"`
+}
+
+//ParseCurve builds the curve described by definition
+func ParseCurve(definition CurveJSON) (*Curve, error) {
+	switch definition.Type {
+	case "linear":
+		return LinearCurve(), nil
+	case "gamma":
+		if definition.Gamma <= 0 {
+			return nil, fmt.Errorf("Invalid gamma: %v", definition.Gamma)
+		}
+		return GammaCurve(definition.Gamma), nil
+	case "cie":
+		return CIECurve(), nil
+	case "lut":
+		return LUTCurve(definition.LUT)
+	default:
+		return nil, fmt.Errorf("Unknown curve type: %s", definition.Type)
+	}
+}
+
+//LoadCurves reads a JSON file of output curves keyed by fixture name, like
+//{"sink": {"type": "cie"}, "shower": {"type": "gamma", "gamma": 2.2}}
+func LoadCurves(path string) (map[string]*Curve, error) {
+	jsonData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	definitions := map[string]CurveJSON{}
+	if err := json.Unmarshal(jsonData, &definitions); err != nil {
+		return nil, err
+	}
+	curves := map[string]*Curve{}
+	for name, definition := range definitions {
+		curve, err := ParseCurve(definition)
+		if err != nil {
+			return nil, fmt.Errorf("Fixture %s: %s", name, err)
+		}
+		curves[name] = curve
+	}
+	return curves, nil
+}
+
+//SetCurves gives the fixtures with the same name their curve, erroring on names that aren't fixtures
+func SetCurves(fixtures []*Fixture, curves map[string]*Curve) error {
+	known := map[string]*Fixture{}
+	for _, f := range fixtures {
+		known[f.Name] = f
+	}
+	for name, curve := range curves {
+		f, ok := known[name]
+		if !ok {
+			return fmt.Errorf("Curve for unknown fixture %s", name)
+		}
+		f.Curve = curve
+	}
+	return nil
+}
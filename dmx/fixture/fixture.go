@@ -0,0 +1,295 @@
+package fixture
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rltvty/go-home/dmx/default_loop"
+)
+
+//Attribute is the function a single DMX channel serves on a fixture
+type Attribute string
+
+const (
+	Red    Attribute = "red"
+	Green  Attribute = "green"
+	Blue   Attribute = "blue"
+	White  Attribute = "white"
+	Amber  Attribute = "amber"
+	UV     Attribute = "uv"
+	Dimmer Attribute = "dimmer"
+	Strobe Attribute = "strobe"
+	Unused Attribute = "unused"
+
+	//fine channels carry the low byte of a 16 bit attribute
+	RedFine    Attribute = "red-fine"
+	GreenFine  Attribute = "green-fine"
+	BlueFine   Attribute = "blue-fine"
+	WhiteFine  Attribute = "white-fine"
+	AmberFine  Attribute = "amber-fine"
+	UVFine     Attribute = "uv-fine"
+	DimmerFine Attribute = "dimmer-fine"
+)
+
+//coarse maps each fine attribute to the attribute it refines
+var coarse = map[Attribute]Attribute{
+	RedFine:    Red,
+	GreenFine:  Green,
+	BlueFine:   Blue,
+	WhiteFine:  White,
+	AmberFine:  Amber,
+	UVFine:     UV,
+	DimmerFine: Dimmer,
+}
+
+//Profile is a named fixture personality, listing the attribute of each channel in order
+type Profile struct {
+	Name     string
+	Channels []Attribute
+	//Defaults holds the values sent on channels that aren't driven by a color, e.g. a master dimmer
+	Defaults map[Attribute]byte
+}
+
+var defaultValues = map[Attribute]byte{
+	Dimmer:     0xFF,
+	DimmerFine: 0xFF,
+	Strobe:     0,
+	Unused:     0,
+}
+
+//Profiles holds the built in fixture personalities, keyed by name
+var Profiles = map[string]Profile{
+	"rgbwau-dimmer": {
+		Name:     "rgbwau-dimmer",
+		Channels: []Attribute{Red, Green, Blue, White, Amber, UV, Dimmer},
+	},
+	"rgbwau-dimmer-strobe": {
+		Name:     "rgbwau-dimmer-strobe",
+		Channels: []Attribute{Dimmer, Red, Green, Blue, White, Amber, UV, Strobe},
+	},
+	"rgbwau": {
+		Name:     "rgbwau",
+		Channels: []Attribute{Red, Green, Blue, White, Amber, UV},
+	},
+	"rgbwa": {
+		Name:     "rgbwa",
+		Channels: []Attribute{Red, Green, Blue, White, Amber},
+	},
+	"rgbw": {
+		Name:     "rgbw",
+		Channels: []Attribute{Red, Green, Blue, White},
+	},
+	"rgb": {
+		Name:     "rgb",
+		Channels: []Attribute{Red, Green, Blue},
+	},
+	"rgbwau-16bit": {
+		Name:     "rgbwau-16bit",
+		Channels: []Attribute{Red, RedFine, Green, GreenFine, Blue, BlueFine, White, WhiteFine, Amber, AmberFine, UV, UVFine},
+	},
+	"dimmer": {
+		Name:     "dimmer",
+		Channels: []Attribute{Dimmer},
+	},
+	"dimmer-16bit": {
+		Name:     "dimmer-16bit",
+		Channels: []Attribute{Dimmer, DimmerFine},
+	},
+}
+
+//Lookup finds a built in profile by name
+func Lookup(name string) (Profile, error) {
+	profile, ok := Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(Profiles))
+		for known := range Profiles {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return Profile{}, fmt.Errorf("Unknown fixture profile: %s (known profiles: %v)", name, names)
+	}
+	return profile, nil
+}
+
+//Footprint is the number of DMX channels the profile occupies
+func (p Profile) Footprint() int {
+	return len(p.Channels)
+}
+
+//Has reports whether the profile has a channel for the attribute
+func (p Profile) Has(attribute Attribute) bool {
+	for _, channel := range p.Channels {
+		if channel == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Profile) defaultValue(attribute Attribute) byte {
+	if value, ok := p.Defaults[attribute]; ok {
+		return value
+	}
+	return defaultValues[attribute]
+}
+
+//Render converts color into channel values for the profile.  Emitters the fixture doesn't have are
+//approximated with the ones it does, e.g. amber becomes red plus some green on an RGB fixture.
+func (p Profile) Render(color default_loop.Color) []byte {
+	return p.RenderCurve(color, nil)
+}
+
+//RenderCurve converts color into channel values through an output curve, nil sends the levels straight through
+func (p Profile) RenderCurve(color default_loop.Color, curve *Curve) []byte {
+	levels := p.fold(color)
+	output := func(attribute Attribute) uint16 {
+		if curve == nil {
+			return uint16(clamp(levels[attribute])) * 257
+		}
+		return curve.At(levels[attribute])
+	}
+
+	out := make([]byte, len(p.Channels))
+	for i, channel := range p.Channels {
+		attribute, fine := coarse[channel]
+		if !fine {
+			attribute = channel
+		}
+		driven := false
+		switch attribute {
+		case Red, Green, Blue, White, Amber, UV:
+			driven = true
+		case Dimmer:
+			driven = !p.hasColor()
+		}
+		switch {
+		case !driven:
+			out[i] = p.defaultValue(channel)
+		case fine:
+			out[i] = byte(output(attribute))
+		default:
+			out[i] = byte(output(attribute) >> 8)
+		}
+	}
+	return out
+}
+
+func (p Profile) hasColor() bool {
+	for _, channel := range p.Channels {
+		switch channel {
+		case Red, Green, Blue, White, Amber, UV:
+			return true
+		}
+	}
+	return false
+}
+
+//fold redistributes the color across the emitters present on the profile
+func (p Profile) fold(color default_loop.Color) map[Attribute]float64 {
+	levels := map[Attribute]float64{
+		Red:   float64(color.Red),
+		Green: float64(color.Green),
+		Blue:  float64(color.Blue),
+		White: float64(color.White),
+		Amber: float64(color.Amber),
+		UV:    float64(color.UV),
+	}
+
+	if !p.Has(Amber) {
+		//amber LEDs sit around 590nm, which is roughly full red with three quarters green
+		levels[Red] += levels[Amber]
+		levels[Green] += levels[Amber] * 0.75
+		levels[Amber] = 0
+	}
+	if !p.Has(UV) {
+		//the visible part of a UV emitter reads as a dim violet
+		levels[Blue] += levels[UV] * 0.5
+		levels[Red] += levels[UV] * 0.15
+		levels[UV] = 0
+	}
+	if !p.Has(White) {
+		levels[Red] += levels[White]
+		levels[Green] += levels[White]
+		levels[Blue] += levels[White]
+		levels[White] = 0
+	}
+	if !p.hasColor() {
+		//plain dimmers follow the brightest component
+		levels[Dimmer] = 0
+		for _, level := range levels {
+			if level > levels[Dimmer] {
+				levels[Dimmer] = level
+			}
+		}
+		return levels
+	}
+	if !p.Has(Red) && !p.Has(Green) && !p.Has(Blue) {
+		//single color fixtures get the brightest component, so their white/amber still tracks the program
+		brightest := 0.0
+		for _, attribute := range []Attribute{Red, Green, Blue} {
+			if levels[attribute] > brightest {
+				brightest = levels[attribute]
+			}
+		}
+		if p.Has(White) {
+			levels[White] += brightest
+		} else if p.Has(Amber) {
+			levels[Amber] += brightest
+		}
+		levels[Red], levels[Green], levels[Blue] = 0, 0, 0
+	}
+	return levels
+}
+
+func clamp(level float64) byte {
+	switch {
+	case level <= 0:
+		return 0
+	case level >= 255:
+		return 255
+	default:
+		return byte(level + 0.5)
+	}
+}
+
+//Fixture is a profile patched at a start address in a universe
+type Fixture struct {
+	Name    string
+	Profile Profile
+	//Address is the 1-based DMX start address
+	Address int
+	//Calibration describes the fixture's emitters, colors are converted to match the reference fixture when set
+	Calibration *default_loop.Calibration
+	//Curve maps color levels to output levels, nil sends them straight through
+	Curve *Curve
+}
+
+//New builds a fixture from a named profile, checking that it fits in the universe, with optional options
+func New(name string, profileName string, address int, options ...func(*Fixture)) (*Fixture, error) {
+	profile, err := Lookup(profileName)
+	if err != nil {
+		return nil, err
+	}
+	if address < 1 || address+profile.Footprint()-1 > 512 {
+		return nil, fmt.Errorf("Fixture %s with profile %s does not fit at address %d", name, profileName, address)
+	}
+	fixture := Fixture{Name: name, Profile: profile, Address: address}
+	fixture.SetOptions(options...)
+
+	return &fixture, nil
+}
+
+// SetOptions takes one or more option function and applies them in order to Fixture.
+func (f *Fixture) SetOptions(options ...func(*Fixture)) {
+	for _, opt := range options {
+		opt(f)
+	}
+}
+
+//Render writes the fixture's channels for color into a universe frame
+func (f Fixture) Render(color default_loop.Color, frame *[512]byte) {
+	if f.Calibration != nil {
+		color = f.Calibration.Convert(color)
+	}
+	copy(frame[f.Address-1:], f.Profile.RenderCurve(color, f.Curve))
+}
@@ -0,0 +1,13 @@
+package fixture_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestFixture(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fixture Suite")
+}
@@ -0,0 +1,232 @@
+package fixture_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rltvty/go-home/dmx/default_loop"
+	. "github.com/rltvty/go-home/dmx/fixture"
+)
+
+var _ = Describe("Fixture", func() {
+	color := default_loop.Color{Red: 10, Green: 20, Blue: 30, White: 40, Amber: 50, UV: 60}
+
+	Describe("Lookup", func() {
+		It("should find built in profiles", func() {
+			profile, err := Lookup("rgbwau-dimmer")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(profile.Footprint()).To(Equal(7))
+		})
+
+		It("should error on unknown profiles", func() {
+			_, err := Lookup("nope")
+			Expect(err).To(MatchError(ContainSubstring("Unknown fixture profile: nope")))
+		})
+	})
+
+	Describe("Render", func() {
+		Context("with the rgbwau-dimmer profile", func() {
+			It("should match the original frame layout", func() {
+				profile, _ := Lookup("rgbwau-dimmer")
+				Expect(profile.Render(color)).To(Equal([]byte{10, 20, 30, 40, 50, 60, 0xFF}))
+			})
+		})
+
+		Context("with a profile that leads with the dimmer", func() {
+			It("should place each attribute on its own channel", func() {
+				profile, _ := Lookup("rgbwau-dimmer-strobe")
+				Expect(profile.Render(color)).To(Equal([]byte{0xFF, 10, 20, 30, 40, 50, 60, 0}))
+			})
+		})
+
+		Context("with an rgbw fixture", func() {
+			It("should fold amber and uv into red, green and blue", func() {
+				profile, _ := Lookup("rgbw")
+				Expect(profile.Render(default_loop.Color{Amber: 100})).To(Equal([]byte{100, 75, 0, 0}))
+				Expect(profile.Render(default_loop.Color{UV: 100})).To(Equal([]byte{15, 0, 50, 0}))
+			})
+		})
+
+		Context("with an rgb fixture", func() {
+			It("should fold white into every channel", func() {
+				profile, _ := Lookup("rgb")
+				Expect(profile.Render(default_loop.Color{Red: 250, White: 20})).To(Equal([]byte{255, 20, 20}))
+			})
+		})
+
+		Context("with a plain dimmer", func() {
+			It("should follow the brightest component", func() {
+				profile, _ := Lookup("dimmer")
+				Expect(profile.Render(default_loop.Color{Red: 150, Green: 90})).To(Equal([]byte{150}))
+			})
+		})
+
+		Context("with custom defaults", func() {
+			It("should use them for undriven channels", func() {
+				profile := Profile{
+					Name:     "custom",
+					Channels: []Attribute{Red, Strobe},
+					Defaults: map[Attribute]byte{Strobe: 8},
+				}
+				Expect(profile.Render(default_loop.Color{Red: 1})).To(Equal([]byte{1, 8}))
+			})
+		})
+	})
+
+	Describe("Fixture", func() {
+		It("should render at its start address", func() {
+			fixture, err := New("sink", "rgb", 10)
+			Expect(err).NotTo(HaveOccurred())
+			frame := [512]byte{}
+			fixture.Render(default_loop.Color{Red: 1, Green: 2, Blue: 3}, &frame)
+			Expect(frame[8:13]).To(Equal([]byte{0, 1, 2, 3, 0}))
+		})
+
+		It("should refuse fixtures that run past the end of the universe", func() {
+			_, err := New("sink", "rgbwau-dimmer", 510)
+			Expect(err).To(MatchError("Fixture sink with profile rgbwau-dimmer does not fit at address 510"))
+		})
+
+		It("should convert colors with its calibration", func() {
+			//a fixture with a dimmer red, so it needs more of it for the same look
+			calibration := default_loop.Calibration{
+				Red:   &default_loop.Emitter{X: 0.700, Y: 0.299, Luminance: 0.15},
+				Green: default_loop.Reference.Green,
+				Blue:  default_loop.Reference.Blue,
+			}
+			fixture, _ := New("sink", "rgbwau", 1, func(f *Fixture) {
+				f.Calibration = &calibration
+			})
+			frame := [512]byte{}
+			fixture.Render(default_loop.Color{Red: 100, Green: 50, UV: 7}, &frame)
+			Expect(frame[:6]).To(Equal([]byte{200, 50, 0, 0, 0, 7}))
+		})
+	})
+
+	Describe("Curves", func() {
+		It("should leave linear levels alone", func() {
+			curve := LinearCurve()
+			Expect(curve[0]).To(BeNumerically("==", 0))
+			Expect(curve[10]).To(BeNumerically("==", 10*257))
+			Expect(curve[255]).To(BeNumerically("==", 65535))
+		})
+
+		It("should spread the low levels of a gamma curve", func() {
+			curve := GammaCurve(2.2)
+			Expect(curve[128]).To(BeNumerically("~", 14386, 2))
+			Expect(curve[10]).To(BeNumerically("<", 256))
+			Expect(curve[11]).To(BeNumerically(">", curve[10]))
+		})
+
+		It("should treat levels as lightness with the CIE curve", func() {
+			curve := CIECurve()
+			//L* 50 is 18.4% luminance
+			Expect(curve[128]).To(BeNumerically("~", 12155, 100))
+			Expect(curve[255]).To(BeNumerically("==", 65535))
+		})
+
+		It("should interpolate a LUT", func() {
+			curve, err := LUTCurve([]uint16{0, 1000, 65535})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(curve[0]).To(BeNumerically("==", 0))
+			Expect(curve[51]).To(BeNumerically("==", 400))
+			Expect(curve[255]).To(BeNumerically("==", 65535))
+			_, err = LUTCurve([]uint16{1})
+			Expect(err).To(MatchError("A LUT needs at least 2 points"))
+		})
+
+		It("should interpolate fractional levels", func() {
+			Expect(LinearCurve().At(10.5)).To(BeNumerically("==", 2699))
+			Expect(LinearCurve().At(300)).To(BeNumerically("==", 65535))
+		})
+
+		It("should fill fine channels with the low byte", func() {
+			profile, _ := Lookup("rgbwau-16bit")
+			out := profile.RenderCurve(default_loop.Color{Red: 10, UV: 255}, GammaCurve(2.2))
+			red := uint16(out[0])<<8 | uint16(out[1])
+			Expect(red).To(Equal(GammaCurve(2.2)[10]))
+			Expect(out[10:12]).To(Equal([]byte{255, 255}))
+			Expect(out[2:10]).To(Equal(make([]byte, 8)))
+		})
+
+		It("should repeat the level in fine channels without a curve", func() {
+			profile, _ := Lookup("dimmer-16bit")
+			Expect(profile.Render(default_loop.Color{Red: 90})).To(Equal([]byte{90, 90}))
+		})
+
+		It("should default undriven fine channels", func() {
+			profile := Profile{Name: "custom", Channels: []Attribute{Red, Dimmer, DimmerFine}}
+			Expect(profile.RenderCurve(default_loop.Color{Red: 255}, CIECurve())).To(Equal([]byte{255, 255, 255}))
+		})
+
+		It("should render fixtures through their curve", func() {
+			fixture, _ := New("sink", "rgb", 1, func(f *Fixture) {
+				f.Curve = GammaCurve(2.2)
+			})
+			frame := [512]byte{}
+			fixture.Render(default_loop.Color{Red: 128}, &frame)
+			Expect(frame[0]).To(BeNumerically("==", GammaCurve(2.2)[128]>>8))
+		})
+
+		It("should load curves by fixture name", func() {
+			file, _ := ioutil.TempFile("", "curves")
+			defer os.Remove(file.Name())
+			file.WriteString(`{"sink": {"type": "cie"}, "shower": {"type": "gamma", "gamma": 2.4}}`)
+			file.Close()
+
+			curves, err := LoadCurves(file.Name())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*curves["sink"]).To(Equal(*CIECurve()))
+			sink, _ := New("sink", "rgb", 1)
+			Expect(SetCurves([]*Fixture{sink}, curves)).To(MatchError("Curve for unknown fixture shower"))
+		})
+
+		It("should reject unknown curve types", func() {
+			_, err := ParseCurve(CurveJSON{Type: "wobbly"})
+			Expect(err).To(MatchError("Unknown curve type: wobbly"))
+			_, err = ParseCurve(CurveJSON{Type: "gamma"})
+			Expect(err).To(MatchError("Invalid gamma: 0"))
+		})
+	})
+
+	Describe("Calibrations", func() {
+		var path string
+
+		BeforeEach(func() {
+			file, _ := ioutil.TempFile("", "calibration")
+			path = file.Name()
+			file.Close()
+		})
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		It("should load and apply calibrations by fixture name", func() {
+			ioutil.WriteFile(path, []byte(`{"sink": {
+				"red": {"x": 0.69, "y": 0.31, "luminance": 0.28},
+				"green": {"x": 0.17, "y": 0.70, "luminance": 0.62},
+				"blue": {"x": 0.14, "y": 0.05, "luminance": 0.09}
+			}}`), 0644)
+			calibrations, err := LoadCalibrations(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			sink, _ := New("sink", "rgb", 1)
+			shower, _ := New("shower", "rgb", 1)
+			Expect(Calibrate([]*Fixture{sink, shower}, calibrations)).To(Succeed())
+			Expect(sink.Calibration.Red.Luminance).To(Equal(0.28))
+			Expect(shower.Calibration).To(BeNil())
+
+			Expect(Calibrate([]*Fixture{shower}, calibrations)).To(MatchError("Calibration for unknown fixture sink"))
+		})
+
+		It("should reject calibrations without red, green and blue", func() {
+			ioutil.WriteFile(path, []byte(`{"sink": {"white": {"x": 0.31, "y": 0.33, "luminance": 1}}}`), 0644)
+			_, err := LoadCalibrations(path)
+			Expect(err).To(MatchError("Fixture sink: Calibration needs red, green and blue emitters"))
+		})
+	})
+})
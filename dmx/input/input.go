@@ -0,0 +1,367 @@
+package input
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jsimonetti/go-artnet/packet"
+	"github.com/rltvty/go-home/dmx/clock"
+	"github.com/rltvty/go-home/dmx/output"
+)
+
+const defaultTimeout = 10 * time.Second
+
+//artNetPriority is the priority given to Art-Net sources, which have none, the E1.31 default
+const artNetPriority = 100
+
+//Mode is how frames from external sources are merged with the frames the service renders
+type Mode string
+
+const (
+	//HTP takes the highest level of each channel
+	HTP Mode = "htp"
+	//LTP takes the level of each channel that changed last
+	LTP Mode = "ltp"
+	//Takeover sends only the external sources while any are active
+	Takeover Mode = "takeover"
+)
+
+//ParseMode checks a mode name
+func ParseMode(name string) (Mode, error) {
+	switch Mode(name) {
+	case HTP, LTP, Takeover:
+		return Mode(name), nil
+	}
+	return "", fmt.Errorf("Unknown merge mode: %s", name)
+}
+
+//Source is an external controller, like a console, sending a universe
+type Source struct {
+	//ID is the protocol and the sender's IP for Art-Net, or its CID for E1.31
+	ID       string    `json:"id"`
+	Name     string    `json:"name,omitempty"`
+	Universe uint16    `json:"universe"`
+	Priority uint8     `json:"priority"`
+	LastSeen time.Time `json:"lastSeen"`
+
+	frame   output.Frame
+	changed [512]time.Time
+}
+
+//universeState is what LTP needs to know about the frames rendered for a universe
+type universeState struct {
+	frame   output.Frame
+	changed [512]time.Time
+}
+
+//Merger collects the frames external sources send on the universes the service outputs, and merges them into
+//the rendered frames.  A source stops taking part once it has been silent for Timeout.
+type Merger struct {
+	Mode    Mode
+	Timeout time.Duration
+	//LocalIPs are this host's addresses, Art-Net from them is the service's own output
+	LocalIPs []net.IP
+	//LocalCIDs are the CIDs of the service's own E1.31 output, which multicast loops back
+	LocalCIDs [][16]byte
+	//Clock timestamps the E1.31 packets ListenE131 receives
+	Clock clock.Clock
+
+	mu        sync.Mutex
+	sources   map[string]*Source
+	universes map[uint16]*universeState
+}
+
+//New creates a merger in takeover mode, with optional options
+func New(options ...func(*Merger)) *Merger {
+	merger := Merger{
+		Mode:      Takeover,
+		Timeout:   defaultTimeout,
+		Clock:     clock.Real{},
+		sources:   map[string]*Source{},
+		universes: map[uint16]*universeState{},
+	}
+	merger.SetOptions(options...)
+
+	return &merger
+}
+
+// SetOptions takes one or more option function and applies them in order to Merger.
+func (m *Merger) SetOptions(options ...func(*Merger)) {
+	for _, opt := range options {
+		opt(m)
+	}
+}
+
+//Receive records a frame from a source, ID, Name, Universe and Priority identifying it
+func (m *Merger) Receive(source Source, frame output.Frame, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := fmt.Sprintf("%s/%d", source.ID, source.Universe)
+	existing, ok := m.sources[key]
+	if !ok || m.expired(existing, now) {
+		existing = &Source{}
+		for i := range existing.changed {
+			existing.changed[i] = now
+		}
+	} else {
+		for i := range frame {
+			if frame[i] != existing.frame[i] {
+				existing.changed[i] = now
+			}
+		}
+	}
+	existing.ID, existing.Name, existing.Universe, existing.Priority = source.ID, source.Name, source.Universe, source.Priority
+	existing.frame = frame
+	existing.LastSeen = now
+	m.sources[key] = existing
+}
+
+//Stop drops a source straight away, for E1.31 sources that say they are terminating
+func (m *Merger) Stop(id string, universe uint16) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sources, fmt.Sprintf("%s/%d", id, universe))
+}
+
+func (m *Merger) expired(source *Source, now time.Time) bool {
+	return now.Sub(source.LastSeen) >= m.Timeout
+}
+
+//HandleArtNet records an ArtDmx packet from addr, returning false for other packets and the service's own
+func (m *Merger) HandleArtNet(b []byte, addr net.Addr, now time.Time) bool {
+	p, err := packet.Unmarshal(b)
+	if err != nil {
+		return false
+	}
+	dmx, ok := p.(*packet.ArtDMXPacket)
+	if !ok {
+		return false
+	}
+	ip := addrIP(addr)
+	for _, local := range m.LocalIPs {
+		if local.Equal(ip) {
+			return false
+		}
+	}
+	source := Source{
+		ID:       "artnet/" + ip.String(),
+		Universe: uint16(dmx.Net&0x7F)<<8 | uint16(dmx.SubUni),
+		Priority: artNetPriority,
+	}
+	m.Receive(source, dmx.Data, now)
+	return true
+}
+
+func addrIP(addr net.Addr) net.IP {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		return udp.IP
+	}
+	return nil
+}
+
+//E131Packet is the parts of an E1.31 data packet the merger uses
+type E131Packet struct {
+	CID        [16]byte
+	SourceName string
+	Priority   uint8
+	Options    uint8
+	Universe   uint16
+	Data       output.Frame
+}
+
+//E1.31 framing options
+const (
+	optionPreview    = 0x80
+	optionTerminated = 0x40
+)
+
+var errNotE131 = errors.New("Not an E1.31 data packet")
+
+//ParseE131 decodes an E1.31 data packet with the null start code
+func ParseE131(b []byte) (*E131Packet, error) {
+	if len(b) < 126 ||
+		binary.BigEndian.Uint16(b[0:]) != 0x0010 ||
+		!bytes.Equal(b[4:16], []byte("ASC-E1.17\x00\x00\x00")) ||
+		binary.BigEndian.Uint32(b[18:]) != 0x00000004 ||
+		binary.BigEndian.Uint32(b[40:]) != 0x00000002 ||
+		b[117] != 0x02 ||
+		b[125] != 0 {
+		return nil, errNotE131
+	}
+	p := E131Packet{
+		SourceName: string(bytes.TrimRight(b[44:108], "\x00")),
+		Priority:   b[108],
+		Options:    b[112],
+		Universe:   binary.BigEndian.Uint16(b[113:]),
+	}
+	copy(p.CID[:], b[22:38])
+	//the property count includes the start code, and a universe has at most 512 slots
+	slots := int(binary.BigEndian.Uint16(b[123:])) - 1
+	if slots < 0 || slots > len(p.Data) || slots > len(b)-126 {
+		return nil, errNotE131
+	}
+	copy(p.Data[:], b[126:126+slots])
+	return &p, nil
+}
+
+//HandleE131 records an E1.31 data packet, returning false for other packets, previews and the service's own
+func (m *Merger) HandleE131(b []byte, now time.Time) bool {
+	p, err := ParseE131(b)
+	if err != nil || p.Options&optionPreview != 0 {
+		return false
+	}
+	for _, cid := range m.LocalCIDs {
+		if cid == p.CID {
+			return false
+		}
+	}
+	id := "sacn/" + hex.EncodeToString(p.CID[:])
+	if p.Options&optionTerminated != 0 {
+		m.Stop(id, p.Universe)
+		return true
+	}
+	m.Receive(Source{ID: id, Name: p.SourceName, Universe: p.Universe, Priority: p.Priority}, p.Data, now)
+	return true
+}
+
+//active returns the unexpired sources of a universe with the highest priority, dropping expired sources
+func (m *Merger) active(universe uint16, now time.Time) []*Source {
+	var active []*Source
+	var priority uint8
+	for key, source := range m.sources {
+		if m.expired(source, now) {
+			delete(m.sources, key)
+			continue
+		}
+		if source.Universe != universe || source.Priority < priority {
+			continue
+		}
+		if source.Priority > priority {
+			active, priority = nil, source.Priority
+		}
+		active = append(active, source)
+	}
+	return active
+}
+
+//Merge returns the frame to send for a universe, merging ours, the rendered frame, with the active sources
+//of the highest priority on it
+func (m *Merger) Merge(universe uint16, ours output.Frame, now time.Time) output.Frame {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state, ok := m.universes[universe]
+	if !ok {
+		state = &universeState{frame: ours}
+		for i := range state.changed {
+			state.changed[i] = now
+		}
+		m.universes[universe] = state
+	}
+	for i := range ours {
+		if ours[i] != state.frame[i] {
+			state.changed[i] = now
+		}
+	}
+	state.frame = ours
+
+	sources := m.active(universe, now)
+	if len(sources) == 0 {
+		return ours
+	}
+	merged := ours
+	switch m.Mode {
+	case LTP:
+		for i := range merged {
+			latest := state.changed[i]
+			for _, source := range sources {
+				if source.changed[i].After(latest) {
+					merged[i], latest = source.frame[i], source.changed[i]
+				}
+			}
+		}
+	case HTP:
+		for _, source := range sources {
+			for i := range merged {
+				if source.frame[i] > merged[i] {
+					merged[i] = source.frame[i]
+				}
+			}
+		}
+	default:
+		//sources sending the same universe at the same priority are merged HTP, as E1.31 receivers do
+		merged = output.Frame{}
+		for _, source := range sources {
+			for i := range merged {
+				if source.frame[i] > merged[i] {
+					merged[i] = source.frame[i]
+				}
+			}
+		}
+	}
+	return merged
+}
+
+//Sources lists the external sources that haven't timed out
+func (m *Merger) Sources(now time.Time) []Source {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sources := []Source{}
+	for _, source := range m.sources {
+		if !m.expired(source, now) {
+			sources = append(sources, *source)
+		}
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Universe != sources[j].Universe {
+			return sources[i].Universe < sources[j].Universe
+		}
+		return sources[i].ID < sources[j].ID
+	})
+	return sources
+}
+
+//ListenE131 receives E1.31 on the multicast group of each universe, and unicast on the E1.31 port, until quit
+//is closed
+func (m *Merger) ListenE131(universes []uint16, quit chan int) error {
+	var conns []*net.UDPConn
+	for _, universe := range universes {
+		conn, err := net.ListenMulticastUDP("udp4", nil, output.MulticastAddr(universe))
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return err
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		//every socket is bound to the E1.31 port, so each may see packets for any universe, which is harmless
+		go func(conn *net.UDPConn) {
+			buf := make([]byte, 1024)
+			for {
+				n, _, err := conn.ReadFromUDP(buf)
+				if err != nil {
+					return
+				}
+				m.HandleE131(buf[:n], m.Clock.Now())
+			}
+		}(conn)
+	}
+	go func() {
+		<-quit
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,162 @@
+package input_test
+
+import (
+	"net"
+	"time"
+
+	"github.com/jsimonetti/go-artnet/packet"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	. "github.com/rltvty/go-home/dmx/input"
+	"github.com/rltvty/go-home/dmx/output"
+)
+
+//packetConn keeps the last packet written, to build E1.31 packets with the output transport
+type packetConn struct {
+	net.PacketConn
+	last []byte
+}
+
+func (c *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.last = append([]byte{}, b...)
+	return len(b), nil
+}
+
+func e131(cid byte, priority uint8, universe uint8, frame output.Frame) []byte {
+	conn := &packetConn{}
+	transport := output.NewE131(conn, func(e *output.E131) {
+		e.SourceName = "console"
+		e.CID = [16]byte{cid}
+		e.Priority = priority
+	})
+	transport.Send(output.Universe{SubUni: universe}, 1, frame)
+	return conn.last
+}
+
+func artDMX(universe uint8, frame output.Frame) []byte {
+	b, err := (&packet.ArtDMXPacket{SubUni: universe, Data: frame}).MarshalBinary()
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	return b
+}
+
+var _ = Describe("Merger", func() {
+	now := time.Date(2019, 6, 1, 20, 0, 0, 0, time.UTC)
+	console := &net.UDPAddr{IP: net.IPv4(10, 10, 10, 50), Port: 6454}
+	ours := output.Frame{100, 50, 0}
+	var merger *Merger
+
+	BeforeEach(func() {
+		merger = New()
+	})
+
+	Describe("Merge", func() {
+		It("should send our frame when there are no sources", func() {
+			Expect(merger.Merge(1, ours, now)).To(Equal(ours))
+		})
+
+		DescribeTable("merging with a console",
+			func(mode Mode, expected output.Frame) {
+				merger.Mode = mode
+				merger.Merge(1, ours, now)
+				Expect(merger.HandleArtNet(artDMX(1, output.Frame{20, 200, 0, 30}), console, now.Add(time.Second))).To(BeTrue())
+				//the program fades the first channel after the console took over
+				changed := ours
+				changed[0] = 110
+				Expect(merger.Merge(1, changed, now.Add(2*time.Second))).To(Equal(expected))
+			},
+			Entry("takeover", Takeover, output.Frame{20, 200, 0, 30}),
+			Entry("htp", HTP, output.Frame{110, 200, 0, 30}),
+			Entry("ltp", LTP, output.Frame{110, 200, 0, 30}),
+		)
+
+		It("should take the console's changes in LTP", func() {
+			merger.Mode = LTP
+			merger.Merge(1, ours, now)
+			merger.HandleArtNet(artDMX(1, output.Frame{20, 200}), console, now.Add(time.Second))
+			Expect(merger.Merge(1, ours, now.Add(time.Second))).To(Equal(output.Frame{20, 200}))
+			merger.HandleArtNet(artDMX(1, output.Frame{20, 10}), console, now.Add(2*time.Second))
+			Expect(merger.Merge(1, ours, now.Add(2*time.Second))).To(Equal(output.Frame{20, 10}))
+		})
+
+		It("should hand back once the source times out", func() {
+			merger.HandleArtNet(artDMX(1, output.Frame{20}), console, now)
+			Expect(merger.Merge(1, ours, now.Add(9*time.Second))).To(Equal(output.Frame{20}))
+			Expect(merger.Merge(1, ours, now.Add(10*time.Second))).To(Equal(ours))
+			Expect(merger.Sources(now.Add(10 * time.Second))).To(BeEmpty())
+		})
+
+		It("should only merge sources on the same universe", func() {
+			merger.HandleArtNet(artDMX(2, output.Frame{20}), console, now)
+			Expect(merger.Merge(1, ours, now)).To(Equal(ours))
+		})
+
+		It("should ignore our own Art-Net", func() {
+			merger.LocalIPs = []net.IP{console.IP}
+			Expect(merger.HandleArtNet(artDMX(1, output.Frame{20}), console, now)).To(BeFalse())
+			Expect(merger.Merge(1, ours, now)).To(Equal(ours))
+		})
+	})
+
+	Describe("E1.31", func() {
+		It("should parse data packets", func() {
+			p, err := ParseE131(e131(7, 150, 1, output.Frame{1, 2, 3}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.CID).To(Equal([16]byte{7}))
+			Expect(p.SourceName).To(Equal("console"))
+			Expect(p.Priority).To(Equal(uint8(150)))
+			Expect(p.Universe).To(Equal(uint16(1)))
+			Expect(p.Data).To(Equal(output.Frame{1, 2, 3}))
+
+			_, err = ParseE131(artDMX(1, output.Frame{}))
+			Expect(err).To(MatchError("Not an E1.31 data packet"))
+		})
+
+		It("should reject packets without a start code", func() {
+			b := e131(7, 150, 1, output.Frame{1})
+			b[123], b[124] = 0, 0
+			_, err := ParseE131(b)
+			Expect(err).To(MatchError("Not an E1.31 data packet"))
+		})
+
+		It("should reject packets with more than 512 slots", func() {
+			b := append(e131(7, 150, 1, output.Frame{1}), make([]byte, 100)...)
+			b[123], b[124] = 0x02, 0x58
+			_, err := ParseE131(b)
+			Expect(err).To(MatchError("Not an E1.31 data packet"))
+		})
+
+		It("should merge only the highest priority sources", func() {
+			Expect(merger.HandleE131(e131(1, 100, 1, output.Frame{50, 0, 0}), now)).To(BeTrue())
+			Expect(merger.HandleE131(e131(2, 150, 1, output.Frame{0, 80, 0}), now)).To(BeTrue())
+			Expect(merger.HandleE131(e131(3, 150, 1, output.Frame{0, 0, 90}), now)).To(BeTrue())
+			Expect(merger.Merge(1, ours, now)).To(Equal(output.Frame{0, 80, 90}))
+			Expect(merger.Sources(now)).To(HaveLen(3))
+			Expect(merger.Sources(now)[0].Name).To(Equal("console"))
+		})
+
+		It("should drop sources that terminate their stream", func() {
+			merger.HandleE131(e131(1, 100, 1, output.Frame{50}), now)
+			terminated := e131(1, 100, 1, output.Frame{50})
+			terminated[112] = 0x40
+			Expect(merger.HandleE131(terminated, now)).To(BeTrue())
+			Expect(merger.Merge(1, ours, now)).To(Equal(ours))
+		})
+
+		It("should ignore previews and our own output", func() {
+			preview := e131(1, 100, 1, output.Frame{50})
+			preview[112] = 0x80
+			Expect(merger.HandleE131(preview, now)).To(BeFalse())
+			merger.LocalCIDs = [][16]byte{{2}}
+			Expect(merger.HandleE131(e131(2, 100, 1, output.Frame{50}), now)).To(BeFalse())
+			Expect(merger.Merge(1, ours, now)).To(Equal(ours))
+		})
+	})
+
+	It("should parse modes", func() {
+		Expect(ParseMode("ltp")).To(Equal(LTP))
+		_, err := ParseMode("lifo")
+		Expect(err).To(MatchError("Unknown merge mode: lifo"))
+	})
+})
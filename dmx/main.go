@@ -1,34 +1,85 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"github.com/rltvty/go-home/dmx/alarm"
+	"github.com/rltvty/go-home/dmx/calendar"
+	"github.com/rltvty/go-home/dmx/control"
 	"github.com/rltvty/go-home/dmx/default_loop"
+	"github.com/rltvty/go-home/dmx/discovery"
+	"github.com/rltvty/go-home/dmx/fixture"
+	"github.com/rltvty/go-home/dmx/input"
+	"github.com/rltvty/go-home/dmx/master"
+	"github.com/rltvty/go-home/dmx/mqtt"
+	"github.com/rltvty/go-home/dmx/notify"
+	"github.com/rltvty/go-home/dmx/output"
+	"github.com/rltvty/go-home/dmx/program"
+	"github.com/rltvty/go-home/dmx/simulate"
+	"github.com/rltvty/go-home/dmx/state"
+	"github.com/rltvty/go-home/dmx/zone"
+	"math"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
-	"go.uber.org/zap"
-
 	"github.com/rltvty/go-home/dmx/astronomy"
+	"github.com/rltvty/go-home/dmx/clock"
+	"github.com/rltvty/go-home/dmx/presence"
 
 	"github.com/jsimonetti/go-artnet/packet"
 	"github.com/julienschmidt/httprouter"
 	"github.com/rltvty/go-home/logwrapper"
 	"github.com/rltvty/go-home/netutils"
-    "github.com/RobinUS2/golang-moving-average"
 )
 
-const movingAverageSize = 1000
+var refreshRate = flag.Float64("refresh-rate", 40, "DMX frames sent per second, 1 to 44")
+var latitude = flag.Float64("latitude", 30.262890, "latitude of the lights, for astronomical events")
+var longitude = flag.Float64("longitude", -97.720119, "longitude of the lights, for astronomical events")
+var sunriseAPI = flag.Bool("sunrise-api", false, "get astronomical events from sunrise-sunset.org instead of calculating them")
+var zonesPath = flag.String("zones", "", "JSON nodes, fixtures, zones and groups of zones, defaults to the bathroom sink and shower")
+var programPath = flag.String("program", "", "JSON lighting program to run instead of the built in default loop, reloaded when it changes")
+var schedulePath = flag.String("schedule", "", "JSON schedule choosing the program to run each day, overrides -program")
+var wakeTimes = flag.String("wake", "", "wake alarm times, like weekday=06:30,sat=08:00")
+var alarmRamp = flag.Duration("alarm-ramp", 30*time.Minute, "how long the wake alarm ramps up before the wake time, 20m to 45m")
+var calibrationPath = flag.String("calibration", "", "JSON emitter calibrations by fixture name, so colors look the same on different fixtures")
+var curvesPath = flag.String("curves", "", "JSON output curves by fixture name, for smooth fades at low levels")
+var notificationsPath = flag.String("notifications", "", "JSON notifications by name, added to the doorbell, timer and message presets")
+var mqttBroker = flag.String("mqtt-broker", "", "host:port of an MQTT broker to take notifications from")
+var mqttTopic = flag.String("mqtt-topic", "dmx/notify/+", "MQTT topic filter for notifications, the last topic level names the fixture or group")
+var presenceZones = flag.String("presence", "", "zones with occupancy sensors and their hold times, fixtures or groups, like bathroom=5m,sink=90s")
+var presenceVacant = flag.Float64("presence-vacant", 0.1, "how bright the program is shown in a vacant zone, 0 to 1")
+var presenceTopic = flag.String("presence-topic", "dmx/presence/+", "MQTT topic filter for occupancy, the last topic level names the zone")
+var presenceSerial = flag.String("presence-serial", "", "serial port or pipe a sensor writes lines like \"bathroom motion\" to")
+var stateDir = flag.String("state", "", "directory the mode, overrides, master levels and last output are saved to, and restored from on start")
+var masterState = flag.String("master-state", "", "JSON file the master levels and schedule are saved to, and restored from on start")
+var masterSchedule = flag.String("master-schedule", "", "daily master levels, replacing the saved schedule, like 23:00=0.3,07:00=1,bedroom@21:30=0.5")
+var sacnNodes = flag.String("sacn", "", "nodes to drive with E1.31 instead of Art-Net, multicast unless =unicast, like sink,shower=unicast")
+var sacnSource = flag.String("sacn-source", "go-home dmx", "E1.31 source name")
+var sacnPriority = flag.Int("sacn-priority", 100, "E1.31 priority, 0 to 200")
+var sacnCID = flag.String("sacn-cid", "", "E1.31 CID as a UUID, defaults to one derived from the source and host names")
+var inputMerge = flag.String("input", "takeover", "how Art-Net and E1.31 from consoles on our universes is merged: takeover, htp, ltp or off")
+var inputTimeout = flag.Duration("input-timeout", 10*time.Second, "how long after a console stops sending the schedule takes back over")
+var simulateDate = flag.String("simulate", "", "simulate a day, like 2019-06-21, as fast as possible instead of sending DMX")
+var simulateStep = flag.Duration("simulate-step", time.Second, "how far simulated time moves between frames")
+var recordPath = flag.String("record", "", "record every frame of a simulation to a .csv or .json file")
+var timelinePath = flag.String("timeline", "", "draw the fixture colors over a simulation to a .svg, .html or .png file")
+var timezone = flag.String("timezone", "", "IANA time zone the programs run in, like America/Chicago, defaults to the system's")
+var clockStart = flag.String("clock-start", "", "run the clock from this local time, like 2019-06-21T05:00, instead of now")
+var clockSpeed = flag.Float64("clock-speed", 1, "how many times faster than real time the clock runs, like 60 to watch an hour a minute")
+var artSync = flag.Bool("artsync", false, "broadcast ArtSync after frames that update Art-Net universes")
 
 func index(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	fmt.Fprint(w, "Welcome!\n")
 }
 
-func hello(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	fmt.Fprintf(w, "hello, %s!\n", ps.ByName("name"))
-}
-
 // The type of our middleware consists of the original handler we want to wrap and a message
 type Middleware struct {
 	next http.Handler
@@ -71,45 +122,570 @@ func udpAddress(ip string) string {
 	return fmt.Sprintf("%s:%d", ip, packet.ArtNetPort)
 }
 
-func sendDMX(conn *net.UDPConn, node *net.UDPAddr, universe uint8, data [512]byte) {
-	p := &packet.ArtDMXPacket{
-		Sequence: 0,
-		SubUni:   universe,
-		Net:      0,
-		Data:     data,
+//node is an Art-Net or E1.31 node along with the fixtures patched on its universe
+type node struct {
+	name     string
+	addr     *net.UDPAddr
+	universe uint8
+	fixtures []*fixture.Fixture
+}
+
+//frame renders each fixture on the node with the color chosen for it
+func (n node) frame(colorFor func(f *fixture.Fixture) default_loop.Color) output.Frame {
+	var data output.Frame
+	for _, f := range n.fixtures {
+		f.Render(colorFor(f), (*[512]byte)(&data))
+	}
+	return data
+}
+
+//nodeTransports parses the -sacn list into the E1.31 transport for each node named, nodes not named use Art-Net
+func nodeTransports(list string, conn net.PacketConn) (map[string]output.Transport, error) {
+	if *sacnPriority < 0 || *sacnPriority > 200 {
+		return nil, fmt.Errorf("Invalid E1.31 priority: %d", *sacnPriority)
+	}
+	//a zero CID is derived from the source name
+	var cid [16]byte
+	if *sacnCID != "" {
+		var err error
+		if cid, err = output.ParseCID(*sacnCID); err != nil {
+			return nil, err
+		}
+	}
+	options := func(e *output.E131) {
+		e.SourceName = *sacnSource
+		e.Priority = uint8(*sacnPriority)
+		e.CID = cid
+	}
+	multicast := output.NewE131(conn, options)
+	unicast := output.NewE131(conn, options, func(e *output.E131) {
+		e.Multicast = false
+	})
+
+	transports := map[string]output.Transport{}
+	for _, item := range strings.Split(list, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if parts[0] == "" {
+			continue
+		}
+		switch {
+		case len(parts) == 1 || parts[1] == "multicast":
+			transports[parts[0]] = multicast
+		case parts[1] == "unicast":
+			transports[parts[0]] = unicast
+		default:
+			return nil, errors.New("Invalid E1.31 node: " + item)
+		}
 	}
+	return transports, nil
+}
 
-	b, err := p.MarshalBinary()
+//programFunc returns the program color at now, and the name of the active cue
+type programFunc func(now time.Time, days []astronomy.Day) (default_loop.Color, string)
+
+//loadProgram watches the program file at path, an empty path is the built in default loop
+func loadProgram(path string) programFunc {
+	if path == "" {
+		return default_loop.Program
+	}
+	watcher, err := program.NewWatcher(path)
+	if err != nil {
+		logwrapper.GetInstance().PanicError("Unable to load program", err)
+	}
+	go watcher.Watch(5*time.Second, make(chan int))
+	return func(now time.Time, days []astronomy.Day) (default_loop.Color, string) {
+		return watcher.Program().Evaluate(now, days)
+	}
+}
 
-	//n, err := conn.WriteTo(b, node)
-	_, err = conn.WriteTo(b, node)
+//loadSchedule watches the programs of the schedule file at path, choosing between them by the controller's mode
+func loadSchedule(path string, controller *control.Controller) programFunc {
+	schedule, err := calendar.Load(path)
 	if err != nil {
-		now := time.Now()
-		if now.Second() % 60 == 0 {
-			fmt.Printf("Time is: %s  Error Writing packet: %s\n", now.Local().Format("15:04"), err)
+		logwrapper.GetInstance().PanicError("Unable to load schedule", err)
+	}
+	programs := map[string]programFunc{}
+	for name, path := range schedule.Programs {
+		programs[name] = loadProgram(path)
+	}
+	return func(now time.Time, days []astronomy.Day) (default_loop.Color, string) {
+		name := schedule.Select(now, controller.Mode())
+		color, cue := programs[name](now, days)
+		return color, name + "/" + cue
+	}
+}
+
+//zonePrograms loads the program or schedule of each zone, zones without either run -schedule or -program.  Zones
+//that share a file share its program.
+func zonePrograms(config *zone.Config, controller *control.Controller) map[string]programFunc {
+	loaded := map[string]programFunc{}
+	load := func(program string, schedule string) programFunc {
+		key := "program:" + program
+		if schedule != "" {
+			key = "schedule:" + schedule
+		}
+		if run, ok := loaded[key]; ok {
+			return run
 		}
+		var run programFunc
+		if schedule != "" {
+			run = loadSchedule(schedule, controller)
+		} else {
+			run = loadProgram(program)
+		}
+		loaded[key] = run
+		return run
+	}
 
-		return
+	programs := map[string]programFunc{}
+	for name, z := range config.Zones {
+		if z.Program == "" && z.Schedule == "" {
+			programs[name] = load(*programPath, *schedulePath)
+		} else {
+			programs[name] = load(z.Program, z.Schedule)
+		}
+	}
+	return programs
+}
+
+//newNodes patches the fixtures of each node in the zone config
+func newNodes(config *zone.Config) ([]node, error) {
+	nodes := []node{}
+	for _, n := range config.Nodes {
+		addr, err := net.ResolveUDPAddr("udp", udpAddress(n.IP))
+		if err != nil {
+			return nil, err
+		}
+		patched := node{name: n.Name, addr: addr, universe: n.Universe}
+		for _, f := range n.Fixtures {
+			patch, err := fixture.New(f.Name, f.Profile, f.Address)
+			if err != nil {
+				return nil, err
+			}
+			patched.fixtures = append(patched.fixtures, patch)
+		}
+		nodes = append(nodes, patched)
+	}
+	return nodes, nil
+}
+
+//newClock builds the clock the service runs on from -timezone, -clock-start and -clock-speed
+func newClock() (clock.Clock, *time.Location, error) {
+	location := time.Local
+	if *timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(*timezone); err != nil {
+			return nil, nil, err
+		}
+		//schedules, alarm dates and logs work in the local zone
+		time.Local = location
+	}
+	if *clockSpeed <= 0 {
+		return nil, nil, fmt.Errorf("Clock speed must be more than 0, not %g", *clockSpeed)
 	}
-	//fmt.Printf("packet sent, wrote %d bytes\n", n)
+	system := clock.Real{Location: location}
+	if *clockStart == "" && *clockSpeed == 1 {
+		return system, location, nil
+	}
+	start := system.Now()
+	if *clockStart != "" {
+		var err error
+		if start, err = time.ParseInLocation("2006-01-02T15:04", *clockStart, location); err != nil {
+			return nil, nil, err
+		}
+	}
+	return clock.NewAccelerated(start, *clockSpeed, func(a *clock.Accelerated) {
+		a.Source = system
+	}), location, nil
+}
+
+//receive reads incoming Art-Net packets, handing ArtPollReplys to the registry and ArtDmx to the merger,
+//if input is enabled
+func receive(conn *net.UDPConn, registry *discovery.Registry, merger *input.Merger, clk clock.Clock) {
+	log := logwrapper.GetInstance()
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			log.InfoError("Error reading packet", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		now := clk.Now()
+		if !registry.HandlePacket(buf[:n], now) && merger != nil {
+			merger.HandleArtNet(buf[:n], addr, now)
+		}
+	}
+}
+
+//simulateDay renders the -simulate day as fast as it can, recording the frames and drawing the timeline
+func simulateDay(render func(now time.Time) []output.Frame, controller *control.Controller, nodes []node, fixtureNames []string,
+	location *time.Location) {
+	log := logwrapper.GetInstance()
+	start, err := time.ParseInLocation("2006-01-02", *simulateDate, location)
+	if err != nil {
+		log.PanicError("Invalid simulation date", err)
+	}
+
+	var recorder simulate.Recorder
+	if *recordPath != "" {
+		universes := []uint16{}
+		channels := 1
+		for _, n := range nodes {
+			universes = append(universes, uint16(n.universe))
+			for _, f := range n.fixtures {
+				if last := f.Address + f.Profile.Footprint() - 1; last > channels {
+					channels = last
+				}
+			}
+		}
+		recorder, err = simulate.NewRecorder(*recordPath, universes, channels)
+		if err != nil {
+			log.PanicError("Unable to record", err)
+		}
+	}
+	timeline := simulate.NewTimeline(fixtureNames)
+
+	simulator := simulate.New(start, func(s *simulate.Simulator) {
+		s.Step = *simulateStep
+	})
+	err = simulator.Run(func(now time.Time) error {
+		frames := render(now)
+		status := controller.Status(now)
+		colors := make([]default_loop.Color, len(status.Fixtures))
+		for i, f := range status.Fixtures {
+			colors[i] = f.Output
+		}
+		timeline.Add(now, colors, status.Program)
+		if recorder != nil {
+			return recorder.Record(now, frames)
+		}
+		return nil
+	})
+	if recorder != nil {
+		if closeErr := recorder.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		log.PanicError("Unable to record", err)
+	}
+	if *timelinePath != "" {
+		if err := timeline.Save(*timelinePath); err != nil {
+			log.PanicError("Unable to save timeline", err)
+		}
+	}
+}
+
+//mqttNotify shows the notifications received over MQTT.  The payload is a notification like the body of
+//POST /notify/:target, or just the name of one.
+func mqttNotify(controller *control.Controller, library notify.Library, clk clock.Clock) mqtt.Handler {
+	return func(topic string, payload []byte) {
+		log := logwrapper.GetInstance()
+		target := topic[strings.LastIndex(topic, "/")+1:]
+
+		var definition notify.NotificationJSON
+		if text := strings.TrimSpace(string(payload)); !strings.HasPrefix(text, "{") {
+			definition.Name = text
+		} else if err := json.Unmarshal(payload, &definition); err != nil {
+			log.InfoError("Invalid notification on "+topic, err)
+			return
+		}
+		notification, err := library.Parse(definition)
+		if err == nil {
+			_, err = controller.Notify(target, *notification, clk.Now())
+		}
+		if err != nil {
+			log.InfoError("Unable to notify "+target, err)
+		}
+	}
+}
+
+//fixtureZones maps each fixture to the presence zones it is in, zones being fixtures or groups
+func fixtureZones(zones []string, fixtures []string, groups map[string][]string) (map[string][]string, error) {
+	inZones := map[string][]string{}
+	for _, zone := range zones {
+		members, ok := groups[zone]
+		if !ok {
+			for _, name := range fixtures {
+				if name == zone {
+					members, ok = []string{name}, true
+				}
+			}
+		}
+		if !ok {
+			return nil, errors.New("Unknown fixture or group: " + zone)
+		}
+		for _, member := range members {
+			inZones[member] = append(inZones[member], zone)
+		}
+	}
+	return inZones, nil
+}
+
+//mqttPresence records the occupancy signals received over MQTT, the last topic level naming the zone
+func mqttPresence(tracker *presence.Tracker, clk clock.Clock) mqtt.Handler {
+	return func(topic string, payload []byte) {
+		zone := topic[strings.LastIndex(topic, "/")+1:]
+		signal, err := presence.ParseSignal(payload)
+		if err == nil {
+			err = tracker.Signal(zone, signal, clk.Now())
+		}
+		if err != nil {
+			logwrapper.GetInstance().InfoError("Invalid presence on "+topic, err)
+		}
+	}
+}
+
+//readSensor reads occupancy signals from a serial port or pipe, reopening it whenever it closes
+func readSensor(path string, tracker *presence.Tracker, clk clock.Clock) {
+	log := logwrapper.GetInstance()
+	report := func(line string, err error) {
+		log.InfoError("Invalid presence line: "+line, err)
+	}
+	for {
+		f, err := os.Open(path)
+		if err == nil {
+			err = tracker.ReadSignals(f, clk.Now, report)
+			f.Close()
+		}
+		if err != nil {
+			log.InfoError("Unable to read presence sensor", err)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+//saveState saves the state periodically, and once more when the service is stopped
+func saveState(store *state.Store, controller *control.Controller, clk clock.Clock) {
+	quit := make(chan int)
+	done := make(chan int)
+	go func() {
+		store.Run(controller, clk, quit)
+		close(done)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	close(quit)
+	<-done
+	logwrapper.GetInstance().Info("Saved state, exiting")
+	os.Exit(0)
 }
 
 func main() {
+	flag.Parse()
 	log := logwrapper.GetInstance()
 	defer log.Sync()
-	/*
-		router := httprouter.New()
-		router.GET("/", index)
-		router.GET("/hello/:name", hello)
 
-		log.Fatal(http.ListenAndServe(":8080", NewMiddleware(router)))
-	*/
+	clk, location, err := newClock()
+	if err != nil {
+		log.PanicError("Invalid clock", err)
+	}
+	//Art-Net allows at most 44 frames a second, and a rate that isn't positive can't drive the ticker
+	if *refreshRate < 1 || *refreshRate > 44 {
+		log.PanicError("Invalid refresh rate", fmt.Errorf("Refresh rate must be between 1 and 44, not %g", *refreshRate))
+	}
+
+	calculator := astronomy.NewCalculator(func(c *astronomy.Calculator) {
+		c.Latitude = *latitude
+		c.Longitude = *longitude
+		c.Clock = clk
+	})
+	sources := []astronomy.Source{calculator.GetEventsFor}
+	if *sunriseAPI {
+		api := astronomy.New(func(api *astronomy.API) {
+			api.Latitude = *latitude
+			api.Longitude = *longitude
+		})
+		sources = []astronomy.Source{api.GetEventsFor, calculator.GetEventsFor}
+	}
+	provider := astronomy.NewProvider(sources, func(p *astronomy.Provider) {
+		p.Clock = clk
+		//the API can take seconds, which mustn't stall the frames, but a simulation waits for its answer
+		if *sunriseAPI && *simulateDate == "" {
+			p.Fallback = calculator.GetEventsFor
+		}
+	})
+	if _, err := provider.Today(); err != nil {
+		log.PanicError("Unable to get astronomical events", err)
+	}
+
+	rooms := zone.Bathroom()
+	if *zonesPath != "" {
+		rooms, err = zone.Load(*zonesPath)
+		if err != nil {
+			log.PanicError("Unable to load zones", err)
+		}
+	}
+	nodes, err := newNodes(rooms)
+	if err != nil {
+		log.PanicError("Unable to patch fixtures", err)
+	}
+	fixtures := []*fixture.Fixture{}
+	fixtureNames := []string{}
+	for _, n := range nodes {
+		for _, f := range n.fixtures {
+			fixtures = append(fixtures, f)
+			fixtureNames = append(fixtureNames, f.Name)
+		}
+	}
+	if *calibrationPath != "" {
+		calibrations, err := fixture.LoadCalibrations(*calibrationPath)
+		if err == nil {
+			err = fixture.Calibrate(fixtures, calibrations)
+		}
+		if err != nil {
+			log.PanicError("Unable to load calibrations", err)
+		}
+	}
+	if *curvesPath != "" {
+		curves, err := fixture.LoadCurves(*curvesPath)
+		if err == nil {
+			err = fixture.SetCurves(fixtures, curves)
+		}
+		if err != nil {
+			log.PanicError("Unable to load curves", err)
+		}
+	}
+	//zones and groups of zones are addressed like groups of fixtures
+	controller, err := control.New(fixtureNames, rooms.Targets())
+	if err != nil {
+		log.PanicError("Unable to create controller", err)
+	}
+
+	wakeAlarm := alarm.New()
+	if err := wakeAlarm.SetRamp(*alarmRamp); err != nil {
+		log.PanicError("Invalid alarm ramp", err)
+	}
+	if err := wakeAlarm.SetWakeTimes(*wakeTimes); err != nil {
+		log.PanicError("Invalid wake times", err)
+	}
+
+	sensors, err := presence.ParseZones(*presenceZones)
+	if err != nil {
+		log.PanicError("Invalid presence zones", err)
+	}
+	tracker := presence.New(sensors, func(t *presence.Tracker) {
+		t.VacantLevel = *presenceVacant
+	})
+	inZones, err := fixtureZones(tracker.Zones(), fixtureNames, controller.Groups())
+	if err != nil {
+		log.PanicError("Invalid presence zones", err)
+	}
+
+	targets := controller.Groups()
+	for _, name := range fixtureNames {
+		targets[name] = []string{name}
+	}
+	levels := master.New(targets, func(m *master.Master) {
+		m.Path = *masterState
+		if m.Path == "" && *stateDir != "" {
+			m.Path = filepath.Join(*stateDir, "master.json")
+		}
+	})
+	if err := levels.Load(); err != nil {
+		log.PanicError("Unable to restore master levels", err)
+	}
+	if *masterSchedule != "" {
+		steps, err := master.ParseSchedule(*masterSchedule)
+		if err == nil {
+			err = levels.SetSchedule(steps)
+		}
+		if err != nil {
+			log.PanicError("Invalid master schedule", err)
+		}
+	}
+
+	library := notify.NewLibrary()
+	if *notificationsPath != "" {
+		library, err = notify.LoadLibrary(*notificationsPath)
+		if err != nil {
+			log.PanicError("Unable to load notifications", err)
+		}
+	}
+
+	programs := zonePrograms(rooms, controller)
+	zoneNames := rooms.Names()
+	zoneOf := rooms.ZoneOf()
 
-	//10.10.10.20 on universe 1 -> Sink
-	//10.10.10.21 on universe 0 -> Shower
+	//in a simulation the lines would scroll by too fast to read
+	logInterval := time.Minute
+	if *simulateDate != "" {
+		logInterval = time.Hour
+	}
+	var lastLog time.Time
+	var merger *input.Merger
+	//a simulation starts from the program, and leaves the saved state alone
+	var store *state.Store
+	if *stateDir != "" && *simulateDate == "" {
+		store = state.New(filepath.Join(*stateDir, "state.json"))
+		if err := store.Load(controller, clk.Now()); err != nil {
+			log.PanicError("Unable to restore state", err)
+		}
+	}
+	render := func(now time.Time) []output.Frame {
+		days, _ := provider.Days(now)
+		alarmColor, alarmOn := wakeAlarm.Color(now)
+		logging := now.Sub(lastLog) >= logInterval
+		if logging {
+			lastLog = now
+		}
+
+		colors := map[string]default_loop.Color{}
+		alarmed := map[string]bool{}
+		for i, name := range zoneNames {
+			color, programName := programs[name](now, days)
+			if alarmOn && rooms.Zones[name].HasAlarm() {
+				color, programName, alarmed[name] = alarmColor, "alarm", true
+			}
+			colors[name] = color
+
+			if logging {
+				fmt.Printf("Time is: %s  Zone: %s  On Program: %s  Program Color: %s\n", now.Format("15:04"), name, programName, color)
+			}
+			controller.ReportZone(name, programName, color)
+			//the first zone stands in for the whole program, for clients from before zones
+			if i == 0 {
+				controller.ReportProgram(programName, color)
+			}
+		}
+
+		colorFor := func(f *fixture.Fixture) default_loop.Color {
+			//the program is dimmed in vacant zones, the alarm, manual colors, effects and notifications aren't
+			programColor := colors[zoneOf[f.Name]]
+			if zones := inZones[f.Name]; len(zones) > 0 && !alarmed[zoneOf[f.Name]] {
+				level := 0.0
+				for _, sensor := range zones {
+					level = math.Max(level, tracker.Level(sensor, now))
+				}
+				programColor = default_loop.Scale(programColor, level)
+			}
+			fixtureColor := levels.Apply(f.Name, controller.Color(f.Name, programColor, now), now)
+			if store != nil {
+				fixtureColor = store.Output(f.Name, fixtureColor, now)
+			}
+			controller.ReportOutput(f.Name, fixtureColor)
+			return fixtureColor
+		}
+		frames := make([]output.Frame, len(nodes))
+		for i, n := range nodes {
+			frames[i] = n.frame(colorFor)
+			if merger != nil {
+				frames[i] = merger.Merge(uint16(n.universe), frames[i], now)
+			}
+		}
+		return frames
+	}
 
-	events, _ := astronomy.New().GetEvents()
-	log.Info("Got astronomical events", zap.String("events", events.String()))
+	if *simulateDate != "" {
+		simulateDay(render, controller, nodes, fixtureNames, location)
+		return
+	}
+	if store != nil {
+		go saveState(store, controller, clk)
+	}
 
 	ips := netutils.GetConnectedIPV4s()
 	if len(ips) == 0 {
@@ -117,63 +693,96 @@ func main() {
 	}
 	ip := ips[0]
 
-	sink, _ := net.ResolveUDPAddr("udp", udpAddress("10.10.10.20"))
-	shower, _ := net.ResolveUDPAddr("udp", udpAddress("10.10.10.21"))
-	src := fmt.Sprintf("%s:%d", ip.String(), packet.ArtNetPort)
-	localAddr, _ := net.ResolveUDPAddr("udp", src)
+	if *mqttBroker != "" {
+		go mqtt.NewSubscriber(*mqttBroker, *mqttTopic).Run(mqttNotify(controller, library, clk), make(chan int))
+		if len(sensors) > 0 {
+			subscriber := mqtt.NewSubscriber(*mqttBroker, *presenceTopic, func(s *mqtt.Subscriber) {
+				s.ClientID = "go-home-dmx-presence"
+			})
+			go subscriber.Run(mqttPresence(tracker, clk), make(chan int))
+		}
+	}
+	if *presenceSerial != "" {
+		go readSensor(*presenceSerial, tracker, clk)
+	}
+
+	// listen on all addresses, so broadcast ArtPollReplys from older nodes are received too
+	localAddr := &net.UDPAddr{Port: packet.ArtNetPort}
 
 	conn, err := net.ListenUDP("udp", localAddr)
 	if err != nil {
 
-
 		fmt.Printf("error opening udp: %s\n", err)
 		return
 	}
 
-	// set channels 1 and 7 to FL, 2-6 to zero
-	// should set full red
-
-	go func() {
-		//now := time.Now()
-		red := movingaverage.New(movingAverageSize)
-		blue := movingaverage.New(movingAverageSize)
-		green := movingaverage.New(movingAverageSize)
-		white := movingaverage.New(movingAverageSize)
-		amber := movingaverage.New(movingAverageSize)
-		uv := movingaverage.New(movingAverageSize)
-
-		for {
-			now := time.Now()
-			color, program := default_loop.Program(now, *events)
-			red.Add(float64(color.Red))
-			blue.Add(float64(color.Blue))
-			green.Add(float64(color.Green))
-			white.Add(float64(color.White))
-			amber.Add(float64(color.Amber))
-			uv.Add(float64(color.UV))
-
-			output := default_loop.Color{
-				Red:   byte(red.Avg()),
-				Blue:  byte(blue.Avg()),
-				Green: byte(green.Avg()),
-				White: byte(white.Avg()),
-				Amber: byte(amber.Avg()),
-				UV:    byte(uv.Avg()),
-			}
+	if *inputMerge != "off" {
+		mode, err := input.ParseMode(*inputMerge)
+		if err != nil {
+			log.PanicError("Invalid input merge", err)
+		}
+		merger = input.New(func(m *input.Merger) {
+			m.Mode = mode
+			m.Timeout = *inputTimeout
+			m.LocalIPs = ips
+			m.Clock = clk
+		})
+	}
 
-			if now.Second() % 60 == 0 {
-				fmt.Printf("Time is: %s  On Program: %s  Program Color: %s  Output Color: %s\n", now.Local().Format("15:04"), program, color, output)
-			}
+	registry := discovery.NewRegistry()
+	broadcast, err := netutils.GetIPV4Broadcast(ip)
+	if err != nil {
+		log.InfoError("Unable to find broadcast address, Art-Net discovery disabled", err)
+	} else {
+		go registry.Poll(conn, broadcast, make(chan int))
+	}
+	go receive(conn, registry, merger, clk)
 
-			sendDMX(conn, sink, 1, [512]byte{output.Red, output.Green, output.Blue, output.White, output.Amber, output.UV, 0xFF})
-			sendDMX(conn, shower, 0, [512]byte{output.Red, output.Green, output.Blue, output.White, output.Amber, output.UV, 0xFF})
-			time.Sleep(time.Millisecond * 1000)
-			//now = now.Add(time.Minute)
-		}
+	go func() {
+		router := newRouter(controller, registry, wakeAlarm, library, merger, tracker, levels, clk)
+		log.PanicError("HTTP server stopped", http.ListenAndServe(":8080", NewMiddleware(router)))
 	}()
 
-	for {
-		time.Sleep(time.Second)
+	transports, err := nodeTransports(*sacnNodes, conn)
+	if err != nil {
+		log.PanicError("Invalid E1.31 settings", err)
+	}
+	if merger != nil {
+		for _, transport := range transports {
+			merger.LocalCIDs = append(merger.LocalCIDs, transport.(*output.E131).CID)
+		}
 	}
+	universes := make([]output.Universe, len(nodes))
+	sacnUniverses := []uint16{}
+	for i, n := range nodes {
+		universes[i] = output.Universe{Addr: n.addr, SubUni: n.universe, Transport: transports[n.name]}
+		delete(transports, n.name)
+		//consoles can send E1.31 to any universe it can number, whichever protocol the node is driven with
+		if number, err := output.E131Universe(universes[i]); err == nil {
+			sacnUniverses = append(sacnUniverses, number)
+		}
+		if universes[i].Transport == nil {
+			continue
+		}
+		if _, err := output.E131Universe(universes[i]); err != nil {
+			log.PanicError("Node "+n.name+" can't use E1.31", err)
+		}
+	}
+	for name := range transports {
+		log.PanicError("Invalid E1.31 settings", errors.New("Unknown node: "+name))
+	}
+	if merger != nil {
+		if err := merger.ListenE131(sacnUniverses, make(chan int)); err != nil {
+			log.InfoError("Unable to listen for E1.31, only Art-Net input is merged", err)
+		}
+	}
+	engine := output.New(conn, universes, func(e *output.Engine) {
+		e.RefreshRate = *refreshRate
+		e.Clock = clk
+		if *artSync && broadcast != nil {
+			e.SyncAddr = &net.UDPAddr{IP: broadcast, Port: packet.ArtNetPort}
+		}
+	})
 
+	engine.Run(render, make(chan int))
 }
@@ -0,0 +1,337 @@
+package master
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rltvty/go-home/dmx/default_loop"
+	"github.com/rltvty/go-home/dmx/state"
+	"github.com/rltvty/go-home/logwrapper"
+)
+
+//Global is the target of the master over every fixture
+const Global = "all"
+
+const clockFormat = "15:04"
+
+//Step is a scheduled change of a master level, every day at a clock time
+type Step struct {
+	//Target is the fixture or group the step sets the master of, empty for the global master
+	Target string `json:"target,omitempty"`
+	//At is the clock time, like "23:00"
+	At    string  `json:"at"`
+	Level float64 `json:"level"`
+
+	clock time.Duration
+}
+
+//target is the fixture or group name of the step, Global for the global master
+func (s Step) target() string {
+	if s.Target == "" {
+		return Global
+	}
+	return s.Target
+}
+
+//Setting is a master level set over the API, which holds until the next scheduled step for its target
+type Setting struct {
+	Level float64   `json:"level"`
+	Set   time.Time `json:"set"`
+}
+
+//saved is what is saved to disk
+type saved struct {
+	Levels   map[string]Setting `json:"levels"`
+	Schedule []Step             `json:"schedule"`
+}
+
+//TargetStatus is the master level of a fixture or group
+type TargetStatus struct {
+	Target string  `json:"target"`
+	Level  float64 `json:"level"`
+	//Manual is set when the level was set over the API rather than by the schedule
+	Manual bool `json:"manual"`
+}
+
+//Status is every master level that isn't full, and the schedule
+type Status struct {
+	Levels   []TargetStatus `json:"levels"`
+	Schedule []Step         `json:"schedule"`
+}
+
+//Master scales the output of fixtures, with a global level and one for each fixture or group, which multiply.
+//Levels are set over the API or by a daily schedule, whichever changed last, and are saved to Path.
+type Master struct {
+	//Targets maps each fixture and group name, including Global, to the fixtures in it
+	Targets map[string][]string
+	//Path is where levels and the schedule are saved when they change, empty doesn't save them
+	Path string
+
+	mu       sync.Mutex
+	levels   map[string]Setting
+	schedule []Step
+	version  int
+
+	saveMu  sync.Mutex
+	written int
+}
+
+//New creates a master at full for the targets, with optional options
+func New(targets map[string][]string, options ...func(*Master)) *Master {
+	master := Master{
+		Targets: targets,
+		levels:  map[string]Setting{},
+	}
+	master.SetOptions(options...)
+
+	return &master
+}
+
+// SetOptions takes one or more option function and applies them in order to Master.
+func (m *Master) SetOptions(options ...func(*Master)) {
+	for _, opt := range options {
+		opt(m)
+	}
+}
+
+//Load restores the levels and schedule saved at Path, if it has been saved to
+func (m *Master) Load() error {
+	b, err := ioutil.ReadFile(m.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var restored saved
+	if err := json.Unmarshal(b, &restored); err != nil {
+		return err
+	}
+	for target, setting := range restored.Levels {
+		if err := m.check(target, setting.Level); err != nil {
+			return err
+		}
+	}
+	schedule, err := m.parseSteps(restored.Schedule)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if restored.Levels != nil {
+		m.levels = restored.Levels
+	}
+	m.schedule = schedule
+	return nil
+}
+
+//settings copies the levels and schedule to save, numbered so an older copy is never written over a newer one.
+//It is called with the lock held.
+func (m *Master) settings() (saved, int) {
+	levels := map[string]Setting{}
+	for target, setting := range m.levels {
+		levels[target] = setting
+	}
+	m.version++
+	return saved{Levels: levels, Schedule: append([]Step{}, m.schedule...)}, m.version
+}
+
+//save writes settings to Path, logging any failure, since the levels still apply until a restart.  It is called
+//without the lock, which Level takes every frame, so the disk write doesn't hold up rendering.
+func (m *Master) save(settings saved, version int) {
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+	if version <= m.written {
+		return
+	}
+	m.written = version
+	if err := m.write(settings); err != nil {
+		logwrapper.GetInstance().InfoError("Unable to save master levels", err)
+	}
+}
+
+//write writes settings to Path
+func (m *Master) write(settings saved) error {
+	if m.Path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return state.WriteFile(m.Path, b)
+}
+
+func (m *Master) check(target string, level float64) error {
+	if _, ok := m.Targets[target]; !ok {
+		return fmt.Errorf("Unknown fixture or group: %s", target)
+	}
+	if level < 0 || level > 1 {
+		return errors.New("Master level must be between 0 and 1")
+	}
+	return nil
+}
+
+//Set sets the master level of a fixture, group or Global, until the next scheduled step for it
+func (m *Master) Set(target string, level float64, now time.Time) error {
+	if err := m.check(target, level); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.levels[target] = Setting{Level: level, Set: now}
+	settings, version := m.settings()
+	m.mu.Unlock()
+	m.save(settings, version)
+	return nil
+}
+
+//Clear drops the level set on a fixture, group or Global, returning it to the schedule, or full
+func (m *Master) Clear(target string) error {
+	if _, ok := m.Targets[target]; !ok {
+		return fmt.Errorf("Unknown fixture or group: %s", target)
+	}
+
+	m.mu.Lock()
+	delete(m.levels, target)
+	settings, version := m.settings()
+	m.mu.Unlock()
+	m.save(settings, version)
+	return nil
+}
+
+//ParseSchedule parses a list like "23:00=0.3,07:00=1,bedroom@21:30=0.5", a step without a target being for the
+//global master
+func ParseSchedule(list string) ([]Step, error) {
+	steps := []Step{}
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid master step: " + item)
+		}
+		level, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			return nil, errors.New("Invalid master step: " + item)
+		}
+		step := Step{At: strings.TrimSpace(parts[0]), Level: level}
+		if at := strings.SplitN(step.At, "@", 2); len(at) == 2 {
+			step.Target, step.At = at[0], at[1]
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+//parseSteps checks each step, filling in its clock time
+func (m *Master) parseSteps(steps []Step) ([]Step, error) {
+	parsed := []Step{}
+	for _, step := range steps {
+		if step.Target == Global {
+			step.Target = ""
+		}
+		if err := m.check(step.target(), step.Level); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(clockFormat, step.At)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid clock time: %s", step.At)
+		}
+		step.clock = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		parsed = append(parsed, step)
+	}
+	return parsed, nil
+}
+
+//SetSchedule replaces the daily schedule
+func (m *Master) SetSchedule(steps []Step) error {
+	parsed, err := m.parseSteps(steps)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.schedule = parsed
+	settings, version := m.settings()
+	m.mu.Unlock()
+	m.save(settings, version)
+	return nil
+}
+
+//level returns the level of a target at now, and whether it was set manually
+func (m *Master) level(target string, now time.Time) (float64, bool) {
+	var last time.Time
+	level := 1.0
+	for _, step := range m.schedule {
+		if step.target() != target {
+			continue
+		}
+		at := default_loop.ClockOn(now, step.clock)
+		if at.After(now) {
+			at = default_loop.ClockOn(now.AddDate(0, 0, -1), step.clock)
+		}
+		if at.After(last) {
+			last, level = at, step.Level
+		}
+	}
+	if setting, ok := m.levels[target]; ok && !setting.Set.Before(last) {
+		return setting.Level, true
+	}
+	return level, false
+}
+
+//Level returns the product of the master levels over a fixture
+func (m *Master) Level(fixture string, now time.Time) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	level := 1.0
+	for target, fixtures := range m.Targets {
+		for _, name := range fixtures {
+			if name == fixture {
+				l, _ := m.level(target, now)
+				level *= l
+				break
+			}
+		}
+	}
+	return level
+}
+
+//Apply scales a fixture's color by its master level
+func (m *Master) Apply(fixture string, color default_loop.Color, now time.Time) default_loop.Color {
+	level := m.Level(fixture, now)
+	if level == 1 {
+		return color
+	}
+	return default_loop.Scale(color, level)
+}
+
+//Status returns the levels of the targets that aren't at full or were set manually, and the schedule
+func (m *Master) Status(now time.Time) Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := Status{Levels: []TargetStatus{}, Schedule: append([]Step{}, m.schedule...)}
+	for target := range m.Targets {
+		level, manual := m.level(target, now)
+		if level != 1 || manual {
+			status.Levels = append(status.Levels, TargetStatus{Target: target, Level: level, Manual: manual})
+		}
+	}
+	sort.Slice(status.Levels, func(i, j int) bool {
+		return status.Levels[i].Target < status.Levels[j].Target
+	})
+	return status
+}
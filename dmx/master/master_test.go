@@ -0,0 +1,123 @@
+package master_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rltvty/go-home/dmx/default_loop"
+	. "github.com/rltvty/go-home/dmx/master"
+)
+
+var _ = Describe("Master", func() {
+	now := time.Date(2019, 6, 21, 22, 0, 0, 0, time.UTC)
+	targets := map[string][]string{
+		Global:     {"sink", "shower"},
+		"bathroom": {"sink", "shower"},
+		"sink":     {"sink"},
+		"shower":   {"shower"},
+	}
+	var master *Master
+
+	BeforeEach(func() {
+		master = New(targets)
+	})
+
+	It("should start at full", func() {
+		Expect(master.Level("sink", now)).To(Equal(1.0))
+		Expect(master.Status(now).Levels).To(BeEmpty())
+	})
+
+	It("should multiply the levels over a fixture", func() {
+		Expect(master.Set(Global, 0.5, now)).To(Succeed())
+		Expect(master.Set("sink", 0.5, now)).To(Succeed())
+		Expect(master.Level("sink", now)).To(Equal(0.25))
+		Expect(master.Level("shower", now)).To(Equal(0.5))
+		Expect(master.Apply("sink", default_loop.Color{Red: 200}, now)).To(Equal(default_loop.Color{Red: 50}))
+	})
+
+	It("should reject unknown targets and levels out of range", func() {
+		Expect(master.Set("kitchen", 0.5, now)).To(MatchError("Unknown fixture or group: kitchen"))
+		Expect(master.Set("sink", 1.5, now)).To(MatchError("Master level must be between 0 and 1"))
+		Expect(master.Clear("kitchen")).To(MatchError("Unknown fixture or group: kitchen"))
+	})
+
+	It("should go back to full when cleared", func() {
+		master.Set("bathroom", 0.3, now)
+		Expect(master.Clear("bathroom")).To(Succeed())
+		Expect(master.Level("sink", now)).To(Equal(1.0))
+	})
+
+	Describe("schedule", func() {
+		BeforeEach(func() {
+			steps, err := ParseSchedule("23:00=0.3, 07:00=1, bathroom@21:30=0.5, bathroom@07:00=1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(master.SetSchedule(steps)).To(Succeed())
+		})
+
+		It("should follow the last step before now", func() {
+			Expect(master.Level("sink", now)).To(Equal(0.5))
+			Expect(master.Level("sink", now.Add(90*time.Minute))).To(Equal(0.15))
+			Expect(master.Level("sink", now.Add(9*time.Hour))).To(Equal(1.0))
+			Expect(master.Level("sink", now.Add(-time.Hour))).To(Equal(1.0))
+		})
+
+		It("should hold a level set over the API until the next step", func() {
+			master.Set(Global, 0.8, now)
+			Expect(master.Level("shower", now.Add(30*time.Minute))).To(Equal(0.4))
+			Expect(master.Level("shower", now.Add(time.Hour))).To(Equal(0.15))
+			Expect(master.Status(now).Levels).To(Equal([]TargetStatus{
+				{Target: Global, Level: 0.8, Manual: true},
+				{Target: "bathroom", Level: 0.5},
+			}))
+		})
+
+		It("should reject invalid steps", func() {
+			_, err := ParseSchedule("23:00")
+			Expect(err).To(MatchError("Invalid master step: 23:00"))
+			Expect(master.SetSchedule([]Step{{At: "25:00", Level: 1}})).To(MatchError("Invalid clock time: 25:00"))
+			Expect(master.SetSchedule([]Step{{Target: "kitchen", At: "21:00", Level: 1}})).To(MatchError("Unknown fixture or group: kitchen"))
+		})
+	})
+
+	Describe("saving", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "master")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should restore the levels and schedule", func() {
+			path := filepath.Join(dir, "master.json")
+			master.Path = path
+			Expect(master.Load()).To(Succeed())
+			Expect(master.Set("shower", 0.4, now)).To(Succeed())
+			Expect(master.SetSchedule([]Step{{At: "23:00", Level: 0.3}, {At: "07:00", Level: 1}})).To(Succeed())
+
+			restored := New(targets, func(m *Master) {
+				m.Path = path
+			})
+			Expect(restored.Load()).To(Succeed())
+			Expect(restored.Level("shower", now)).To(Equal(0.4))
+			Expect(restored.Level("shower", now.Add(time.Hour))).To(BeNumerically("~", 0.12, 0.0001))
+			Expect(restored.Status(now).Schedule).To(HaveLen(2))
+		})
+
+		It("should reject saved levels for targets that no longer exist", func() {
+			path := filepath.Join(dir, "master.json")
+			Expect(ioutil.WriteFile(path, []byte(`{"levels": {"kitchen": {"level": 0.5}}}`), 0644)).To(Succeed())
+			master.Path = path
+			Expect(master.Load()).To(MatchError("Unknown fixture or group: kitchen"))
+		})
+	})
+})
@@ -0,0 +1,297 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/rltvty/go-home/logwrapper"
+)
+
+const defaultKeepAlive = 30 * time.Second
+const defaultRetryInterval = 10 * time.Second
+
+//MQTT 3.1.1 control packet types, in the top four bits of the fixed header
+const (
+	typeConnect   = 1
+	typeConnack   = 2
+	typePublish   = 3
+	typePuback    = 4
+	typeSubscribe = 8
+	typeSuback    = 9
+	typePingreq   = 12
+	typePingresp  = 13
+)
+
+//connack return codes 1 to 5
+var refusals = []string{
+	"unacceptable protocol version",
+	"identifier rejected",
+	"server unavailable",
+	"bad user name or password",
+	"not authorized",
+}
+
+//Handler is called with the topic and payload of each message received
+type Handler func(topic string, payload []byte)
+
+//Subscriber is a minimal MQTT 3.1.1 client that subscribes to one topic filter and receives its messages
+type Subscriber struct {
+	//Broker is the host:port of the MQTT broker
+	Broker   string
+	Topic    string
+	ClientID string
+	Username string
+	Password string
+	//KeepAlive is how often the broker is pinged, it drops the connection after 1.5 times this without a packet
+	KeepAlive time.Duration
+	//RetryInterval is how long to wait before reconnecting after the connection is lost
+	RetryInterval time.Duration
+}
+
+//NewSubscriber creates a subscriber to topic on broker, with optional options
+func NewSubscriber(broker string, topic string, options ...func(*Subscriber)) *Subscriber {
+	subscriber := Subscriber{
+		Broker:        broker,
+		Topic:         topic,
+		ClientID:      "go-home-dmx",
+		KeepAlive:     defaultKeepAlive,
+		RetryInterval: defaultRetryInterval,
+	}
+	subscriber.SetOptions(options...)
+
+	return &subscriber
+}
+
+// SetOptions takes one or more option function and applies them in order to Subscriber.
+func (s *Subscriber) SetOptions(options ...func(*Subscriber)) {
+	for _, opt := range options {
+		opt(s)
+	}
+}
+
+//Run connects to the broker and hands each message to handle, reconnecting whenever the connection is lost,
+//until quit is closed
+func (s *Subscriber) Run(handle Handler, quit chan int) {
+	log := logwrapper.GetInstance()
+	for {
+		conn, err := net.DialTimeout("tcp", s.Broker, s.RetryInterval)
+		if err == nil {
+			done := make(chan int)
+			go func() {
+				select {
+				case <-quit:
+					conn.Close()
+				case <-done:
+				}
+			}()
+			err = s.session(conn, handle)
+			close(done)
+			conn.Close()
+		}
+
+		select {
+		case <-quit:
+			return
+		default:
+		}
+		log.InfoError("MQTT connection lost", err)
+		select {
+		case <-quit:
+			return
+		case <-time.After(s.RetryInterval):
+		}
+	}
+}
+
+//session connects and subscribes over conn, then handles messages until the connection fails
+func (s *Subscriber) session(conn net.Conn, handle Handler) error {
+	if err := writePacket(conn, typeConnect<<4, s.connect()); err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(s.KeepAlive))
+	header, body, err := readPacket(conn)
+	if err != nil {
+		return err
+	}
+	if header>>4 != typeConnack || len(body) != 2 {
+		return fmt.Errorf("Expected CONNACK, got packet type %d", header>>4)
+	}
+	if code := int(body[1]); code != 0 {
+		reason := "unknown reason"
+		if code <= len(refusals) {
+			reason = refusals[code-1]
+		}
+		return fmt.Errorf("Connection refused: %s", reason)
+	}
+
+	//packet identifier 1 and QoS 0
+	var subscribe bytes.Buffer
+	subscribe.Write([]byte{0, 1})
+	writeString(&subscribe, s.Topic)
+	subscribe.WriteByte(0)
+	if err := writePacket(conn, typeSubscribe<<4|2, subscribe.Bytes()); err != nil {
+		return err
+	}
+
+	stop := make(chan int)
+	defer close(stop)
+	go s.ping(conn, stop)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(s.KeepAlive * 3 / 2))
+		header, body, err := readPacket(conn)
+		if err != nil {
+			return err
+		}
+		switch header >> 4 {
+		case typeSuback:
+			if len(body) == 3 && body[2] == 0x80 {
+				return fmt.Errorf("Subscription to %s refused", s.Topic)
+			}
+		case typePublish:
+			topic, payload, id, err := parsePublish(header, body)
+			if err != nil {
+				return err
+			}
+			if id != nil {
+				if err := writePacket(conn, typePuback<<4, id); err != nil {
+					return err
+				}
+			}
+			handle(topic, payload)
+		}
+	}
+}
+
+//connect is the body of the CONNECT packet, asking for a clean session
+func (s *Subscriber) connect() []byte {
+	var body bytes.Buffer
+	writeString(&body, "MQTT")
+	body.WriteByte(4)
+	flags := byte(0x02)
+	if s.Username != "" {
+		flags |= 0x80
+	}
+	if s.Password != "" {
+		flags |= 0x40
+	}
+	body.WriteByte(flags)
+	binary.Write(&body, binary.BigEndian, uint16(s.KeepAlive/time.Second))
+	writeString(&body, s.ClientID)
+	if s.Username != "" {
+		writeString(&body, s.Username)
+	}
+	if s.Password != "" {
+		writeString(&body, s.Password)
+	}
+	return body.Bytes()
+}
+
+func (s *Subscriber) ping(conn net.Conn, stop chan int) {
+	ticker := time.NewTicker(s.KeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := writePacket(conn, typePingreq<<4, nil); err != nil {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+//parsePublish returns the topic and payload of a PUBLISH, and its packet identifier if it needs acknowledging
+func parsePublish(header byte, body []byte) (string, []byte, []byte, error) {
+	reader := bytes.NewReader(body)
+	topic, err := readString(reader)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	var id []byte
+	if qos := header >> 1 & 3; qos > 0 {
+		id = make([]byte, 2)
+		if _, err := io.ReadFull(reader, id); err != nil {
+			return "", nil, nil, err
+		}
+		if qos > 1 {
+			//only QoS 0 is subscribed to, so the broker shouldn't send QoS 2
+			id = nil
+		}
+	}
+	payload := make([]byte, reader.Len())
+	reader.Read(payload)
+	return topic, payload, id, nil
+}
+
+//writePacket writes a control packet, header being the packet type and flags
+func writePacket(w io.Writer, header byte, body []byte) error {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+//readPacket reads a control packet, returning its header byte and body
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, nil, err
+	}
+	header := b[0]
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("Malformed remaining length")
+		}
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, nil, err
+		}
+		length += int(b[0]&0x7F) * multiplier
+		multiplier *= 128
+		if b[0]&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(s)))
+	buf.WriteString(s)
+}
+
+func readString(r io.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	s := make([]byte, length)
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", err
+	}
+	return string(s), nil
+}
@@ -0,0 +1,124 @@
+package mqtt_test
+
+import (
+	"io"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/rltvty/go-home/dmx/mqtt"
+)
+
+type message struct {
+	topic   string
+	payload string
+}
+
+//readPacket reads a packet sent to the fake broker, short remaining lengths only
+func readPacket(conn net.Conn) (byte, []byte) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(conn, header)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	body := make([]byte, header[1])
+	_, err = io.ReadFull(conn, body)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	return header[0], body
+}
+
+func mqttString(s string) []byte {
+	return append([]byte{0, byte(len(s))}, s...)
+}
+
+func publish(qos byte, topic string, payload string) []byte {
+	body := mqttString(topic)
+	if qos > 0 {
+		body = append(body, 0, 7)
+	}
+	body = append(body, payload...)
+	return append([]byte{0x30 | qos<<1, byte(len(body))}, body...)
+}
+
+var _ = Describe("Subscriber", func() {
+	var listener net.Listener
+	var messages chan message
+	var quit chan int
+
+	BeforeEach(func() {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		messages = make(chan message, 10)
+		quit = make(chan int)
+	})
+
+	AfterEach(func() {
+		close(quit)
+		listener.Close()
+	})
+
+	run := func() {
+		subscriber := NewSubscriber(listener.Addr().String(), "dmx/notify/+", func(s *Subscriber) {
+			s.ClientID = "bathroom"
+			s.Username = "lights"
+			s.Password = "secret"
+			s.RetryInterval = 50 * time.Millisecond
+		})
+		go subscriber.Run(func(topic string, payload []byte) {
+			messages <- message{topic, string(payload)}
+		}, quit)
+	}
+
+	accept := func() net.Conn {
+		conn, err := listener.Accept()
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		return conn
+	}
+
+	It("should connect, subscribe and receive messages", func() {
+		run()
+		conn := accept()
+		defer conn.Close()
+
+		header, body := readPacket(conn)
+		Expect(header).To(Equal(byte(0x10)))
+		expected := append(mqttString("MQTT"), 4, 0xC2, 0, 30)
+		expected = append(expected, mqttString("bathroom")...)
+		expected = append(expected, mqttString("lights")...)
+		expected = append(expected, mqttString("secret")...)
+		Expect(body).To(Equal(expected))
+		conn.Write([]byte{0x20, 2, 0, 0})
+
+		header, body = readPacket(conn)
+		Expect(header).To(Equal(byte(0x82)))
+		Expect(body).To(Equal(append(append([]byte{0, 1}, mqttString("dmx/notify/+")...), 0)))
+		conn.Write([]byte{0x90, 3, 0, 1, 0})
+
+		conn.Write(publish(0, "dmx/notify/sink", `{"name":"doorbell"}`))
+		Eventually(messages).Should(Receive(Equal(message{"dmx/notify/sink", `{"name":"doorbell"}`})))
+
+		conn.Write(publish(1, "dmx/notify/all", `{"name":"timer"}`))
+		Eventually(messages).Should(Receive(Equal(message{"dmx/notify/all", `{"name":"timer"}`})))
+		header, body = readPacket(conn)
+		Expect(header).To(Equal(byte(0x40)))
+		Expect(body).To(Equal([]byte{0, 7}))
+	})
+
+	It("should reconnect when the connection is refused or lost", func() {
+		run()
+		conn := accept()
+		readPacket(conn)
+		conn.Write([]byte{0x20, 2, 0, 5})
+		conn.Close()
+
+		conn = accept()
+		defer conn.Close()
+		readPacket(conn)
+		conn.Write([]byte{0x20, 2, 0, 0})
+		readPacket(conn)
+		conn.Write(publish(0, "dmx/notify/hall", "{}"))
+		Eventually(messages).Should(Receive(Equal(message{"dmx/notify/hall", "{}"})))
+	})
+})
@@ -0,0 +1,241 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/rltvty/go-home/dmx/default_loop"
+)
+
+const defaultCount = 2
+const defaultOn = 300 * time.Millisecond
+const defaultOff = 300 * time.Millisecond
+const defaultFlash = time.Second
+
+//notifications come over the API and MQTT, so how many blinks and how long they play is capped
+const maxCount = 100
+const maxLength = 5 * time.Minute
+
+//Step is one part of a notification pattern.  A nil color shows the color underneath for the step.
+type Step struct {
+	Color    *default_loop.Color
+	Duration time.Duration
+}
+
+//Notification is a short light pattern shown over the program, manual colors and effects, after which the
+//lights go back to what they would have been showing
+type Notification struct {
+	Name string
+	//Priority decides which notification shows when several are due on a fixture, higher wins
+	Priority int
+	Steps    []Step
+}
+
+//Length is how long the notification takes to play
+func (n Notification) Length() time.Duration {
+	var length time.Duration
+	for _, step := range n.Steps {
+		length += step.Duration
+	}
+	return length
+}
+
+//Render returns the color elapsed into the notification, shown over base.  False once the notification is over.
+func (n Notification) Render(base default_loop.Color, elapsed time.Duration) (default_loop.Color, bool) {
+	if elapsed < 0 {
+		return base, false
+	}
+	for _, step := range n.Steps {
+		if elapsed < step.Duration {
+			if step.Color == nil {
+				return base, true
+			}
+			return *step.Color, true
+		}
+		elapsed -= step.Duration
+	}
+	return base, false
+}
+
+//StepJSON intermediate type for parsing a step
+type StepJSON struct {
+	Color    *default_loop.Color `json:"color"`
+	Duration string              `json:"duration"`
+}
+
+//NotificationJSON intermediate type for parsing a notification.  Either steps are listed, or a pattern is
+//built from a color:
+//
+//	blink: the color count times, on for on and off for off (defaults 2, 300ms and 300ms)
+//	flash: the color once, for on (default 1s)
+type NotificationJSON struct {
+	//Name picks a preset from the library, any other fields set change it
+	Name     string              `json:"name"`
+	Pattern  string              `json:"pattern"`
+	Color    *default_loop.Color `json:"color"`
+	Count    int                 `json:"count"`
+	On       string              `json:"on"`
+	Off      string              `json:"off"`
+	Steps    []StepJSON          `json:"steps"`
+	Priority *int                `json:"priority"`
+}
+
+//Library is the notifications that can be asked for by name
+type Library map[string]NotificationJSON
+
+var white = default_loop.Color{Red: 255, Green: 255, Blue: 255, White: 255}
+var amber = default_loop.Color{Red: 255, Green: 80, Amber: 255}
+var blue = default_loop.Color{Blue: 255}
+
+func priority(p int) *int {
+	return &p
+}
+
+//Presets are the notifications every library starts with
+var Presets = Library{
+	"doorbell": {Pattern: "blink", Color: &white, Count: 3, On: "200ms", Off: "200ms", Priority: priority(20)},
+	"timer":    {Pattern: "blink", Color: &amber, Count: 3, On: "500ms", Off: "500ms", Priority: priority(10)},
+	"message":  {Pattern: "blink", Color: &blue, Count: 2, Priority: priority(5)},
+}
+
+//NewLibrary returns a library of the presets
+func NewLibrary() Library {
+	library := Library{}
+	for name, definition := range Presets {
+		library[name] = definition
+	}
+	return library
+}
+
+//LoadLibrary reads a JSON file of notifications keyed by name, adding them to the presets and replacing presets
+//with the same name.  Every notification is checked to parse.
+func LoadLibrary(path string) (Library, error) {
+	jsonData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	definitions := Library{}
+	if err := json.Unmarshal(jsonData, &definitions); err != nil {
+		return nil, err
+	}
+	library := NewLibrary()
+	for name, definition := range definitions {
+		library[name] = definition
+		if _, err := library.Parse(NotificationJSON{Name: name}); err != nil {
+			return nil, fmt.Errorf("Notification %s: %s", name, err)
+		}
+	}
+	return library, nil
+}
+
+//Parse builds a notification, starting from the preset with the same name if there is one
+func (l Library) Parse(definition NotificationJSON) (*Notification, error) {
+	if preset, ok := l[definition.Name]; ok {
+		definition = merge(preset, definition)
+	} else if definition.Color == nil && len(definition.Steps) == 0 {
+		if definition.Name != "" {
+			return nil, fmt.Errorf("Unknown notification: %s", definition.Name)
+		}
+		return nil, errors.New("A notification needs a color or steps")
+	}
+
+	notification := Notification{Name: definition.Name}
+	if definition.Priority != nil {
+		notification.Priority = *definition.Priority
+	}
+	if len(definition.Steps) > 0 {
+		for _, stepDefinition := range definition.Steps {
+			duration, err := parseDuration(stepDefinition.Duration, 0)
+			if err != nil {
+				return nil, err
+			}
+			notification.Steps = append(notification.Steps, Step{Color: stepDefinition.Color, Duration: duration})
+		}
+		return notification.checkLength()
+	}
+	if definition.Color == nil {
+		return nil, errors.New("A notification needs a color or steps")
+	}
+
+	switch definition.Pattern {
+	case "", "blink":
+		count := definition.Count
+		if count == 0 {
+			count = defaultCount
+		}
+		if count < 0 || count > maxCount {
+			return nil, fmt.Errorf("Invalid count: %d", count)
+		}
+		on, err := parseDuration(definition.On, defaultOn)
+		if err != nil {
+			return nil, err
+		}
+		off, err := parseDuration(definition.Off, defaultOff)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < count; i++ {
+			notification.Steps = append(notification.Steps,
+				Step{Color: definition.Color, Duration: on},
+				Step{Color: &default_loop.Color{}, Duration: off})
+		}
+	case "flash":
+		on, err := parseDuration(definition.On, defaultFlash)
+		if err != nil {
+			return nil, err
+		}
+		notification.Steps = []Step{{Color: definition.Color, Duration: on}}
+	default:
+		return nil, fmt.Errorf("Unknown pattern: %s", definition.Pattern)
+	}
+	return notification.checkLength()
+}
+
+func (n Notification) checkLength() (*Notification, error) {
+	if n.Length() > maxLength {
+		return nil, fmt.Errorf("A notification can't play for longer than %s", maxLength)
+	}
+	return &n, nil
+}
+
+//merge returns the preset with the fields set on definition replacing its own
+func merge(preset NotificationJSON, definition NotificationJSON) NotificationJSON {
+	if definition.Pattern != "" {
+		preset.Pattern = definition.Pattern
+	}
+	if definition.Color != nil {
+		preset.Color = definition.Color
+	}
+	if definition.Count != 0 {
+		preset.Count = definition.Count
+	}
+	if definition.On != "" {
+		preset.On = definition.On
+	}
+	if definition.Off != "" {
+		preset.Off = definition.Off
+	}
+	if len(definition.Steps) > 0 {
+		preset.Steps = definition.Steps
+	}
+	if definition.Priority != nil {
+		preset.Priority = definition.Priority
+	}
+	preset.Name = definition.Name
+	return preset
+}
+
+//parseDuration parses a positive duration, an empty string is fallback, or an error if fallback is zero
+func parseDuration(text string, fallback time.Duration) (time.Duration, error) {
+	if text == "" && fallback > 0 {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("Invalid duration: %s", text)
+	}
+	return duration, nil
+}
@@ -0,0 +1,112 @@
+package notify_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/rltvty/go-home/dmx/default_loop"
+	. "github.com/rltvty/go-home/dmx/notify"
+)
+
+var _ = Describe("Notify", func() {
+	blue := default_loop.Color{Blue: 255}
+	base := default_loop.Color{Red: 150, Amber: 40}
+	library := NewLibrary()
+
+	parse := func(definition NotificationJSON) *Notification {
+		notification, err := library.Parse(definition)
+		ExpectWithOffset(1, err).NotTo(HaveOccurred())
+		return notification
+	}
+
+	Describe("Parse", func() {
+		It("should blink a color twice by default", func() {
+			notification := parse(NotificationJSON{Color: &blue})
+			Expect(notification.Length()).To(Equal(1200 * time.Millisecond))
+			Expect(notification.Steps).To(Equal([]Step{
+				{Color: &blue, Duration: 300 * time.Millisecond},
+				{Color: &default_loop.Color{}, Duration: 300 * time.Millisecond},
+				{Color: &blue, Duration: 300 * time.Millisecond},
+				{Color: &default_loop.Color{}, Duration: 300 * time.Millisecond},
+			}))
+		})
+
+		It("should flash once", func() {
+			notification := parse(NotificationJSON{Pattern: "flash", Color: &blue, On: "2s"})
+			Expect(notification.Steps).To(Equal([]Step{{Color: &blue, Duration: 2 * time.Second}}))
+		})
+
+		It("should take custom steps", func() {
+			notification := parse(NotificationJSON{Steps: []StepJSON{{Color: &blue, Duration: "1s"}, {Duration: "500ms"}}})
+			Expect(notification.Steps).To(Equal([]Step{{Color: &blue, Duration: time.Second}, {Duration: 500 * time.Millisecond}}))
+		})
+
+		It("should start from a preset, changing the fields given", func() {
+			notification := parse(NotificationJSON{Name: "doorbell"})
+			Expect(notification.Name).To(Equal("doorbell"))
+			Expect(notification.Priority).To(Equal(20))
+			Expect(notification.Steps).To(HaveLen(6))
+
+			notification = parse(NotificationJSON{Name: "doorbell", Color: &blue, Count: 1})
+			Expect(notification.Priority).To(Equal(20))
+			Expect(notification.Steps).To(HaveLen(2))
+			Expect(*notification.Steps[0].Color).To(Equal(blue))
+			Expect(notification.Steps[0].Duration).To(Equal(200 * time.Millisecond))
+		})
+
+		DescribeTable("rejecting invalid notifications",
+			func(definition NotificationJSON, message string) {
+				_, err := library.Parse(definition)
+				Expect(err).To(MatchError(message))
+			},
+			Entry("unknown name", NotificationJSON{Name: "washer"}, "Unknown notification: washer"),
+			Entry("nothing to show", NotificationJSON{}, "A notification needs a color or steps"),
+			Entry("unknown pattern", NotificationJSON{Pattern: "wiggle", Color: &blue}, "Unknown pattern: wiggle"),
+			Entry("bad duration", NotificationJSON{Color: &blue, On: "soon"}, "Invalid duration: soon"),
+			Entry("step without a duration", NotificationJSON{Steps: []StepJSON{{Color: &blue}}}, "Invalid duration: "),
+			Entry("negative count", NotificationJSON{Color: &blue, Count: -1}, "Invalid count: -1"),
+			Entry("too many blinks", NotificationJSON{Color: &blue, Count: 1000000000}, "Invalid count: 1000000000"),
+			Entry("too long", NotificationJSON{Color: &blue, Count: 100, On: "5s"}, "A notification can't play for longer than 5m0s"),
+			Entry("too long steps", NotificationJSON{Steps: []StepJSON{{Color: &blue, Duration: "6m"}}}, "A notification can't play for longer than 5m0s"),
+		)
+	})
+
+	Describe("Render", func() {
+		notification := Notification{Steps: []Step{{Color: &blue, Duration: time.Second}, {Duration: time.Second}}}
+
+		It("should show each step in turn, then finish", func() {
+			color, showing := notification.Render(base, 0)
+			Expect(color).To(Equal(blue))
+			Expect(showing).To(BeTrue())
+			color, showing = notification.Render(base, 1500*time.Millisecond)
+			Expect(color).To(Equal(base))
+			Expect(showing).To(BeTrue())
+			color, showing = notification.Render(base, 2*time.Second)
+			Expect(color).To(Equal(base))
+			Expect(showing).To(BeFalse())
+		})
+	})
+
+	Describe("LoadLibrary", func() {
+		It("should add to and replace the presets", func() {
+			loaded, err := LoadLibrary("test_data/notifications.json")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(loaded).To(HaveKey("timer"))
+
+			washer, err := loaded.Parse(NotificationJSON{Name: "washer"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(washer.Priority).To(Equal(8))
+			doorbell, err := loaded.Parse(NotificationJSON{Name: "doorbell"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(doorbell.Length()).To(Equal(2 * time.Second))
+		})
+
+		It("should check every notification", func() {
+			_, err := LoadLibrary("test_data/invalid.json")
+			Expect(err).To(MatchError("Notification washer: Unknown pattern: wiggle"))
+		})
+	})
+})
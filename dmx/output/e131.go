@@ -0,0 +1,158 @@
+package output
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+//E131Port is the UDP port for streaming ACN
+const E131Port = 5568
+
+//MaxE131Universe is the highest E1.31 universe number, 0 isn't a valid universe
+const MaxE131Universe = 63999
+
+const defaultSourceName = "go-home dmx"
+const defaultPriority = 100
+
+//E1.31 data packet layout, for 512 slots
+const (
+	e131Length        = 638
+	rootVectorData    = 0x00000004
+	framingVectorData = 0x00000002
+	dmpVectorSetProp  = 0x02
+)
+
+//acnPacketIdentifier starts the root layer of every ACN packet
+var acnPacketIdentifier = []byte("ASC-E1.17\x00\x00\x00")
+
+//E131 sends streaming ACN (E1.31) data packets, multicast to the universe's group or unicast to its node
+type E131 struct {
+	Conn net.PacketConn
+	//SourceName is shown by receivers and consoles, up to 63 bytes
+	SourceName string
+	//CID identifies this source to receivers, and should stay the same across restarts
+	CID [16]byte
+	//Priority is 0-200, receivers take the highest priority source of a universe
+	Priority uint8
+	//Multicast sends to 239.255.x.y for universe x*256+y, otherwise packets go to the universe's node
+	Multicast bool
+}
+
+//NewE131 creates a multicast E1.31 transport writing to conn, with optional options.  The CID defaults to one
+//derived from the source name and host name.
+func NewE131(conn net.PacketConn, options ...func(*E131)) *E131 {
+	transport := E131{
+		Conn:       conn,
+		SourceName: defaultSourceName,
+		Priority:   defaultPriority,
+		Multicast:  true,
+	}
+	transport.SetOptions(options...)
+	if transport.CID == [16]byte{} {
+		transport.CID = NameCID(transport.SourceName)
+	}
+
+	return &transport
+}
+
+// SetOptions takes one or more option function and applies them in order to E131.
+func (e *E131) SetOptions(options ...func(*E131)) {
+	for _, opt := range options {
+		opt(e)
+	}
+}
+
+//NameCID builds a name based (version 5) UUID from name and the host name, so a source keeps its CID
+//across restarts
+func NameCID(name string) [16]byte {
+	host, _ := os.Hostname()
+	sum := sha1.Sum([]byte(host + "/" + name))
+	var cid [16]byte
+	copy(cid[:], sum[:16])
+	cid[6] = cid[6]&0x0F | 0x50
+	cid[8] = cid[8]&0x3F | 0x80
+	return cid
+}
+
+//ParseCID parses a CID written as a UUID, like "6f1c1f3c-9d2b-4c43-a6a1-2b0e2a7f6c11"
+func ParseCID(text string) ([16]byte, error) {
+	var cid [16]byte
+	b, err := hex.DecodeString(strings.Replace(text, "-", "", -1))
+	if err != nil || len(b) != len(cid) {
+		return cid, fmt.Errorf("Invalid CID: %s", text)
+	}
+	copy(cid[:], b)
+	return cid, nil
+}
+
+//E131Universe returns the E1.31 universe number of a universe, which is its Port-Address
+func E131Universe(universe Universe) (uint16, error) {
+	number := uint16(universe.Net)<<8 | uint16(universe.SubUni)
+	if number == 0 || number > MaxE131Universe {
+		return 0, fmt.Errorf("E1.31 universes are 1 to %d, not %d", MaxE131Universe, number)
+	}
+	return number, nil
+}
+
+//MulticastAddr is the multicast group for an E1.31 universe
+func MulticastAddr(number uint16) *net.UDPAddr {
+	return &net.UDPAddr{IP: net.IPv4(239, 255, byte(number>>8), byte(number)), Port: E131Port}
+}
+
+//Send sends the frame as an E1.31 data packet
+func (e *E131) Send(universe Universe, sequence uint8, frame Frame) error {
+	number, err := E131Universe(universe)
+	if err != nil {
+		return err
+	}
+	addr := MulticastAddr(number)
+	if !e.Multicast {
+		addr = &net.UDPAddr{IP: universe.Addr.IP, Port: E131Port}
+	}
+	_, err = e.Conn.WriteTo(e.packet(number, sequence, frame), addr)
+	return err
+}
+
+//packet builds an E1.31 data packet
+func (e *E131) packet(number uint16, sequence uint8, frame Frame) []byte {
+	b := make([]byte, e131Length)
+
+	//root layer
+	binary.BigEndian.PutUint16(b[0:], 0x0010)
+	copy(b[4:16], acnPacketIdentifier)
+	binary.BigEndian.PutUint16(b[16:], flagsAndLength(e131Length-16))
+	binary.BigEndian.PutUint32(b[18:], rootVectorData)
+	copy(b[22:38], e.CID[:])
+
+	//framing layer, the source name is null terminated
+	binary.BigEndian.PutUint16(b[38:], flagsAndLength(e131Length-38))
+	binary.BigEndian.PutUint32(b[40:], framingVectorData)
+	name := e.SourceName
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	copy(b[44:108], name)
+	b[108] = e.Priority
+	//b[109:111] is the synchronization address, b[112] the options, both unused
+	b[111] = sequence
+	binary.BigEndian.PutUint16(b[113:], number)
+
+	//DMP layer, the start code followed by the slots
+	binary.BigEndian.PutUint16(b[115:], flagsAndLength(e131Length-115))
+	b[117] = dmpVectorSetProp
+	b[118] = 0xa1
+	binary.BigEndian.PutUint16(b[121:], 1)
+	binary.BigEndian.PutUint16(b[123:], uint16(len(frame)+1))
+	copy(b[126:], frame[:])
+	return b
+}
+
+//flagsAndLength is a PDU's flags (always 0x7) and length
+func flagsAndLength(length int) uint16 {
+	return 0x7000 | uint16(length)
+}
@@ -0,0 +1,177 @@
+package output
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/rltvty/go-home/dmx/clock"
+	"github.com/rltvty/go-home/logwrapper"
+)
+
+const defaultRefreshRate = 40
+const defaultKeepAlive = time.Second
+
+//errors writing packets are logged at most this often, since they repeat every frame
+const errorLogInterval = time.Minute
+
+//opSync is the Art-Net OpCode for ArtSync
+const opSync = 0x5200
+
+//protocolVersion is the Art-Net protocol revision
+const protocolVersion = 14
+
+//Frame is the data for one universe
+type Frame [512]byte
+
+//Universe is an Art-Net Port-Address on a node.  With E1.31 the Port-Address is the universe number.
+type Universe struct {
+	Addr *net.UDPAddr
+	//Net is bits 14-8 of the Port-Address
+	Net uint8
+	//SubUni is bits 7-0 of the Port-Address, the Sub-Net and Universe
+	SubUni uint8
+	//Transport sends the universe's frames, nil is Art-Net over the engine's connection
+	Transport Transport
+}
+
+type universeState struct {
+	Universe
+	sequence uint8
+	last     Frame
+	lastSent time.Time
+	sent     bool
+}
+
+//Engine sends universe frames at a fixed refresh rate, each universe with its own transport
+type Engine struct {
+	//RefreshRate is how many frames per second are rendered
+	RefreshRate float64
+	//KeepAlive is how often unchanged frames are resent, so nodes don't time out
+	KeepAlive time.Duration
+	//SyncAddr is where ArtSync is sent after frames that update any Art-Net universe, nil disables ArtSync.  Nodes
+	//that have seen an ArtSync hold each frame until the next one, so it can't be skipped for single universes.
+	SyncAddr *net.UDPAddr
+	//Clock gives the time frames are rendered for, the ticker only paces them
+	Clock clock.Clock
+
+	conn         net.PacketConn
+	universes    []*universeState
+	lastErrorLog time.Time
+}
+
+//New creates an output engine writing to conn, with optional options
+func New(conn net.PacketConn, universes []Universe, options ...func(*Engine)) *Engine {
+	engine := Engine{
+		RefreshRate: defaultRefreshRate,
+		KeepAlive:   defaultKeepAlive,
+		Clock:       clock.Real{},
+		conn:        conn,
+	}
+	for _, universe := range universes {
+		if universe.Transport == nil {
+			universe.Transport = &ArtNet{Conn: conn}
+		}
+		engine.universes = append(engine.universes, &universeState{Universe: universe})
+	}
+	engine.SetOptions(options...)
+
+	return &engine
+}
+
+// SetOptions takes one or more option function and applies them in order to Engine.
+func (e *Engine) SetOptions(options ...func(*Engine)) {
+	for _, opt := range options {
+		opt(e)
+	}
+}
+
+//Sequence returns the sequence number last sent on the i-th universe
+func (e *Engine) Sequence(i int) uint8 {
+	return e.universes[i].sequence
+}
+
+//nextSequence increments the sequence, skipping 0 which tells nodes sequencing is disabled
+func nextSequence(sequence uint8) uint8 {
+	if sequence == 255 {
+		return 1
+	}
+	return sequence + 1
+}
+
+//Tick sends the frames that changed, or are due for a keep alive, returning how many were sent
+func (e *Engine) Tick(now time.Time, frames []Frame) int {
+	sent, artNetSent := 0, 0
+	for i, universe := range e.universes {
+		if i >= len(frames) {
+			break
+		}
+		frame := frames[i]
+		if universe.sent && frame == universe.last && now.Sub(universe.lastSent) < e.KeepAlive {
+			continue
+		}
+		universe.sequence = nextSequence(universe.sequence)
+		if err := universe.Transport.Send(universe.Universe, universe.sequence, frame); err != nil {
+			e.logError(now, "Error writing packet", err)
+			continue
+		}
+		universe.last = frame
+		universe.lastSent = now
+		universe.sent = true
+		sent++
+		if _, ok := universe.Transport.(*ArtNet); ok {
+			artNetSent++
+		}
+	}
+
+	if artNetSent > 0 && e.SyncAddr != nil {
+		e.writeBytes(now, syncPacket(), e.SyncAddr)
+	}
+	return sent
+}
+
+//syncPacket builds an ArtSync, telling nodes in sync mode to output the frames they've buffered
+func syncPacket() []byte {
+	b := make([]byte, 14)
+	copy(b, "Art-Net\x00")
+	binary.LittleEndian.PutUint16(b[8:], opSync)
+	binary.BigEndian.PutUint16(b[10:], protocolVersion)
+	//b[12] and b[13] are Aux1 and Aux2, which must be zero
+	return b
+}
+
+func (e *Engine) writeBytes(now time.Time, b []byte, addr *net.UDPAddr) bool {
+	if _, err := e.conn.WriteTo(b, addr); err != nil {
+		e.logError(now, "Error writing packet", err)
+		return false
+	}
+	return true
+}
+
+func (e *Engine) logError(now time.Time, msg string, err error) {
+	if now.Sub(e.lastErrorLog) < errorLogInterval {
+		return
+	}
+	e.lastErrorLog = now
+	logwrapper.GetInstance().InfoError(msg, err)
+}
+
+//Run renders and sends frames at RefreshRate, or the default rate if it isn't positive, until quit receives
+func (e *Engine) Run(render func(now time.Time) []Frame, quit chan int) {
+	rate := e.RefreshRate
+	if rate <= 0 {
+		rate = defaultRefreshRate
+	}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			now := e.Clock.Now()
+			e.Tick(now, render(now))
+		case <-quit:
+			logwrapper.GetInstance().Info("Output received quit request, exiting...")
+			return
+		}
+	}
+}
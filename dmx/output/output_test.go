@@ -0,0 +1,207 @@
+package output_test
+
+import (
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rltvty/go-home/dmx/clock"
+	. "github.com/rltvty/go-home/dmx/output"
+)
+
+type write struct {
+	payload []byte
+	addr    string
+}
+
+//fakeConn records every write instead of sending it
+type fakeConn struct {
+	writes []write
+}
+
+func (c *fakeConn) ReadFrom(b []byte) (int, net.Addr, error) { return 0, nil, nil }
+func (c *fakeConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.writes = append(c.writes, write{payload: append([]byte{}, b...), addr: addr.String()})
+	return len(b), nil
+}
+func (c *fakeConn) Close() error                       { return nil }
+func (c *fakeConn) LocalAddr() net.Addr                { return nil }
+func (c *fakeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *fakeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *fakeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+var _ = Describe("Engine", func() {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	sink := &net.UDPAddr{IP: net.IPv4(10, 10, 10, 20), Port: 6454}
+	shower := &net.UDPAddr{IP: net.IPv4(10, 10, 10, 21), Port: 6454}
+	broadcast := &net.UDPAddr{IP: net.IPv4(10, 10, 10, 255), Port: 6454}
+	var conn *fakeConn
+	var engine *Engine
+
+	BeforeEach(func() {
+		conn = &fakeConn{}
+		engine = New(conn, []Universe{{Addr: sink, SubUni: 1}, {Addr: shower, SubUni: 0}})
+	})
+
+	Describe("Tick", func() {
+		It("should send every universe on the first frame", func() {
+			Expect(engine.Tick(now, []Frame{{1}, {2}})).To(Equal(2))
+			Expect(conn.writes).To(HaveLen(2))
+			Expect(conn.writes[0].addr).To(Equal("10.10.10.20:6454"))
+			Expect(conn.writes[1].addr).To(Equal("10.10.10.21:6454"))
+		})
+
+		It("should only resend universes that changed", func() {
+			engine.Tick(now, []Frame{{1}, {2}})
+			Expect(engine.Tick(now.Add(25*time.Millisecond), []Frame{{1}, {3}})).To(Equal(1))
+			Expect(conn.writes[2].addr).To(Equal("10.10.10.21:6454"))
+		})
+
+		It("should resend unchanged universes after the keep alive interval", func() {
+			engine.Tick(now, []Frame{{1}, {2}})
+			Expect(engine.Tick(now.Add(999*time.Millisecond), []Frame{{1}, {2}})).To(Equal(0))
+			Expect(engine.Tick(now.Add(time.Second), []Frame{{1}, {2}})).To(Equal(2))
+		})
+
+		It("should increment sequence numbers per universe, skipping zero", func() {
+			engine.Tick(now, []Frame{{1}, {2}})
+			Expect(engine.Sequence(0)).To(Equal(uint8(1)))
+			for i := 2; i <= 255; i++ {
+				engine.Tick(now, []Frame{{byte(i)}, {2}})
+			}
+			Expect(engine.Sequence(0)).To(Equal(uint8(255)))
+			Expect(engine.Sequence(1)).To(Equal(uint8(1)))
+			engine.Tick(now, []Frame{{0}, {2}})
+			Expect(engine.Sequence(0)).To(Equal(uint8(1)))
+		})
+
+		Context("with ArtSync enabled", func() {
+			BeforeEach(func() {
+				engine.SetOptions(func(e *Engine) {
+					e.SyncAddr = broadcast
+				})
+			})
+
+			It("should send an ArtSync after updating several universes", func() {
+				engine.Tick(now, []Frame{{1}, {2}})
+				Expect(conn.writes).To(HaveLen(3))
+				Expect(conn.writes[2].addr).To(Equal("10.10.10.255:6454"))
+				Expect(conn.writes[2].payload).To(Equal([]byte{'A', 'r', 't', '-', 'N', 'e', 't', 0, 0x00, 0x52, 0, 14, 0, 0}))
+			})
+
+			It("should keep sending ArtSync when a single universe changes", func() {
+				engine.Tick(now, []Frame{{1}, {2}})
+				Expect(engine.Tick(now, []Frame{{1}, {3}})).To(Equal(1))
+				Expect(conn.writes).To(HaveLen(5))
+				Expect(conn.writes[3].addr).To(Equal("10.10.10.21:6454"))
+				Expect(conn.writes[4].addr).To(Equal("10.10.10.255:6454"))
+			})
+
+			It("should not send an ArtSync when nothing changed", func() {
+				engine.Tick(now, []Frame{{1}, {2}})
+				Expect(engine.Tick(now, []Frame{{1}, {2}})).To(Equal(0))
+				Expect(conn.writes).To(HaveLen(3))
+			})
+		})
+	})
+
+	Describe("Run", func() {
+		It("should render frames for the time on its clock", func() {
+			engine.SetOptions(func(e *Engine) {
+				e.RefreshRate = 1000
+				e.Clock = clock.NewFixed(now)
+			})
+			quit := make(chan int)
+			var rendered []time.Time
+			engine.Run(func(t time.Time) []Frame {
+				rendered = append(rendered, t)
+				close(quit)
+				return []Frame{{1}, {2}}
+			}, quit)
+			Expect(rendered).To(Equal([]time.Time{now}))
+			Expect(conn.writes).To(HaveLen(2))
+		})
+
+		It("should run at the default rate when the refresh rate isn't positive", func() {
+			engine.SetOptions(func(e *Engine) {
+				e.RefreshRate = 0
+			})
+			quit := make(chan int)
+			engine.Run(func(t time.Time) []Frame {
+				close(quit)
+				return []Frame{{1}, {2}}
+			}, quit)
+			Expect(conn.writes).To(HaveLen(2))
+		})
+	})
+
+	Describe("E1.31", func() {
+		cid := [16]byte{0x6f, 0x1c, 0x1f, 0x3c, 0x9d, 0x2b, 0x4c, 0x43, 0xa6, 0xa1, 0x2b, 0x0e, 0x2a, 0x7f, 0x6c, 0x11}
+		var transport *E131
+
+		BeforeEach(func() {
+			transport = NewE131(conn, func(e *E131) {
+				e.SourceName = "bathroom"
+				e.CID = cid
+				e.Priority = 150
+			})
+			engine = New(conn, []Universe{
+				{Addr: sink, SubUni: 1, Transport: transport},
+				{Addr: shower, Net: 1, SubUni: 2},
+			}, func(e *Engine) {
+				e.SyncAddr = broadcast
+			})
+		})
+
+		It("should send data packets to the universe's multicast group", func() {
+			Expect(engine.Tick(now, []Frame{{1, 2, 3}, {4}})).To(Equal(2))
+			Expect(conn.writes).To(HaveLen(3))
+			Expect(conn.writes[0].addr).To(Equal("239.255.0.1:5568"))
+			Expect(conn.writes[1].addr).To(Equal("10.10.10.21:6454"))
+			Expect(conn.writes[2].addr).To(Equal("10.10.10.255:6454"))
+
+			p := conn.writes[0].payload
+			Expect(p).To(HaveLen(638))
+			Expect(p[:22]).To(Equal([]byte{0, 0x10, 0, 0, 'A', 'S', 'C', '-', 'E', '1', '.', '1', '7', 0, 0, 0, 0x72, 0x6e, 0, 0, 0, 4}))
+			Expect(p[22:38]).To(Equal(cid[:]))
+			Expect(p[38:44]).To(Equal([]byte{0x72, 0x58, 0, 0, 0, 2}))
+			Expect(string(p[44:53])).To(Equal("bathroom\x00"))
+			//priority, sync address, sequence, options and universe
+			Expect(p[108:115]).To(Equal([]byte{150, 0, 0, 1, 0, 0, 1}))
+			Expect(p[115:129]).To(Equal([]byte{0x72, 0x0b, 0x02, 0xa1, 0, 0, 0, 1, 0x02, 0x01, 0, 1, 2, 3}))
+		})
+
+		It("should unicast to the node", func() {
+			transport.Multicast = false
+			engine.Tick(now, []Frame{{1}, {4}})
+			Expect(conn.writes[0].addr).To(Equal("10.10.10.20:5568"))
+		})
+
+		It("should number universes by their Port-Address", func() {
+			Expect(E131Universe(Universe{Net: 1, SubUni: 2})).To(Equal(uint16(258)))
+			Expect(MulticastAddr(258).String()).To(Equal("239.255.1.2:5568"))
+			_, err := E131Universe(Universe{})
+			Expect(err).To(MatchError("E1.31 universes are 1 to 63999, not 0"))
+		})
+
+		It("should not send a universe it can't number", func() {
+			engine = New(conn, []Universe{{Addr: sink, Transport: transport}, {Addr: shower, SubUni: 2}}, func(e *Engine) {
+				e.SyncAddr = broadcast
+			})
+			Expect(engine.Tick(now, []Frame{{1}, {4}})).To(Equal(1))
+			Expect(conn.writes).To(HaveLen(2))
+			Expect(conn.writes[0].addr).To(Equal("10.10.10.21:6454"))
+			Expect(conn.writes[1].addr).To(Equal("10.10.10.255:6454"))
+		})
+
+		It("should parse CIDs", func() {
+			Expect(ParseCID("6f1c1f3c-9d2b-4c43-a6a1-2b0e2a7f6c11")).To(Equal(cid))
+			_, err := ParseCID("6f1c1f3c")
+			Expect(err).To(MatchError("Invalid CID: 6f1c1f3c"))
+			Expect(NameCID("bathroom")).To(Equal(NameCID("bathroom")))
+			Expect(NameCID("bathroom")).NotTo(Equal(NameCID("kitchen")))
+		})
+	})
+})
@@ -0,0 +1,34 @@
+package output
+
+import (
+	"net"
+
+	"github.com/jsimonetti/go-artnet/packet"
+)
+
+//Transport sends frames to a node in one of the DMX over IP protocols
+type Transport interface {
+	//Send sends a universe's frame, with the engine's sequence number for the universe
+	Send(universe Universe, sequence uint8, frame Frame) error
+}
+
+//ArtNet sends ArtDmx packets to each universe's node
+type ArtNet struct {
+	Conn net.PacketConn
+}
+
+//Send sends the frame as an ArtDmx to the universe's address
+func (a *ArtNet) Send(universe Universe, sequence uint8, frame Frame) error {
+	p := &packet.ArtDMXPacket{
+		Sequence: sequence,
+		SubUni:   universe.SubUni,
+		Net:      universe.Net,
+		Data:     frame,
+	}
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = a.Conn.WriteTo(b, universe.Addr)
+	return err
+}
@@ -0,0 +1,255 @@
+package presence
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultHold = 5 * time.Minute
+const defaultVacantLevel = 0.1
+const defaultFadeUp = time.Second
+const defaultFadeDown = time.Minute
+
+//Signal is what an occupancy sensor reports about a zone
+type Signal string
+
+const (
+	//Motion is a momentary trigger, like a PIR sensor or a webhook, the zone stays occupied for its hold time
+	Motion Signal = "motion"
+	//Occupied is reported by sensors that know the zone is occupied, it stays occupied until they report Vacant
+	Occupied Signal = "occupied"
+	//Vacant is reported when a sensor sees the zone empty, it stays occupied for its hold time after
+	Vacant Signal = "vacant"
+)
+
+//ParseSignal reads a sensor payload.  Besides the signal names it takes ON and OFF, true and false, 1 and 0, and
+//JSON with an occupancy field, as zigbee2mqtt sends.
+func ParseSignal(payload []byte) (Signal, error) {
+	text := strings.TrimSpace(string(payload))
+	if strings.HasPrefix(text, "{") {
+		var message struct {
+			Occupancy *bool `json:"occupancy"`
+		}
+		if err := json.Unmarshal(payload, &message); err != nil {
+			return "", err
+		}
+		if message.Occupancy == nil {
+			return "", errors.New("Presence message has no occupancy")
+		}
+		text = fmt.Sprint(*message.Occupancy)
+	}
+	switch strings.ToLower(text) {
+	case "", "motion":
+		return Motion, nil
+	case "occupied", "on", "true", "1":
+		return Occupied, nil
+	case "vacant", "off", "false", "0":
+		return Vacant, nil
+	}
+	return "", fmt.Errorf("Unknown presence signal: %s", text)
+}
+
+//ZoneStatus is the occupancy of a zone
+type ZoneStatus struct {
+	Name     string `json:"name"`
+	Occupied bool   `json:"occupied"`
+	Hold     string `json:"hold"`
+	//Until is when the zone becomes vacant unless there is more motion, left out while a sensor holds it occupied
+	Until *time.Time `json:"until,omitempty"`
+	//Level is how bright the program is shown in the zone, 0 to 1
+	Level float64 `json:"level"`
+}
+
+type zone struct {
+	hold time.Duration
+	//held is set while a sensor reports the zone occupied
+	held bool
+	//release is the last time the zone was known to be occupied, zero if it never has been
+	release time.Time
+	//occupiedSince and from are when the zone last became occupied, and the level it faded up from
+	occupiedSince time.Time
+	from          float64
+}
+
+//Tracker follows the occupancy of zones from sensor signals, and gives the level to show the program at in each.
+//Zones start out vacant.
+type Tracker struct {
+	//VacantLevel is how bright the program is shown in a vacant zone, 0 to 1
+	VacantLevel float64
+	//FadeUp is how long a zone takes to brighten when it becomes occupied
+	FadeUp time.Duration
+	//FadeDown is how long a zone takes to dim once its hold time has passed
+	FadeDown time.Duration
+
+	mu    sync.Mutex
+	zones map[string]*zone
+}
+
+//New creates a tracker for zones, mapping each zone name to its hold time, with optional options
+func New(zones map[string]time.Duration, options ...func(*Tracker)) *Tracker {
+	tracker := Tracker{
+		VacantLevel: defaultVacantLevel,
+		FadeUp:      defaultFadeUp,
+		FadeDown:    defaultFadeDown,
+		zones:       map[string]*zone{},
+	}
+	for name, hold := range zones {
+		tracker.zones[name] = &zone{hold: hold}
+	}
+	tracker.SetOptions(options...)
+
+	return &tracker
+}
+
+// SetOptions takes one or more option function and applies them in order to Tracker.
+func (t *Tracker) SetOptions(options ...func(*Tracker)) {
+	for _, opt := range options {
+		opt(t)
+	}
+}
+
+//ParseZones parses a list like "bathroom=5m,hallway=90s" into hold times by zone, a zone without a time gets
+//the default of 5 minutes
+func ParseZones(list string) (map[string]time.Duration, error) {
+	zones := map[string]time.Duration{}
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		name, hold := strings.TrimSpace(parts[0]), defaultHold
+		if len(parts) == 2 {
+			var err error
+			if hold, err = time.ParseDuration(strings.TrimSpace(parts[1])); err != nil || hold < 0 {
+				return nil, errors.New("Invalid hold time: " + item)
+			}
+		}
+		zones[name] = hold
+	}
+	return zones, nil
+}
+
+//Zones lists the zone names
+func (t *Tracker) Zones() []string {
+	names := []string{}
+	for name := range t.zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//Signal records a sensor signal for a zone
+func (t *Tracker) Signal(name string, signal Signal, now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	z, ok := t.zones[name]
+	if !ok {
+		return fmt.Errorf("Unknown zone: %s", name)
+	}
+	if signal != Motion && signal != Occupied && signal != Vacant {
+		return fmt.Errorf("Unknown presence signal: %s", signal)
+	}
+	if signal != Vacant && !z.occupied(now) {
+		z.from = t.level(z, now)
+		z.occupiedSince = now
+	}
+	switch signal {
+	case Motion:
+		z.release = now
+	case Occupied:
+		z.held = true
+		z.release = now
+	case Vacant:
+		if z.held {
+			z.held = false
+			z.release = now
+		}
+	}
+	return nil
+}
+
+func (z *zone) occupied(now time.Time) bool {
+	return z.held || (!z.release.IsZero() && now.Before(z.release.Add(z.hold)))
+}
+
+//level is how bright the program is in the zone, fading up from where it was when the zone became occupied, or
+//down from full once the hold time has passed
+func (t *Tracker) level(z *zone, now time.Time) float64 {
+	fade := func(from float64, to float64, start time.Time, duration time.Duration) float64 {
+		if duration <= 0 || !now.Before(start.Add(duration)) {
+			return to
+		}
+		return from + (to-from)*float64(now.Sub(start))/float64(duration)
+	}
+	if z.occupied(now) {
+		return fade(z.from, 1, z.occupiedSince, t.FadeUp)
+	}
+	if z.release.IsZero() {
+		return t.VacantLevel
+	}
+	return fade(1, t.VacantLevel, z.release.Add(z.hold), t.FadeDown)
+}
+
+//Level returns how bright the program should be in the zone, 1 for a zone that isn't tracked
+func (t *Tracker) Level(name string, now time.Time) float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	z, ok := t.zones[name]
+	if !ok {
+		return 1
+	}
+	return t.level(z, now)
+}
+
+//Status returns the occupancy of each zone
+func (t *Tracker) Status(now time.Time) []ZoneStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := []ZoneStatus{}
+	for _, name := range t.Zones() {
+		z := t.zones[name]
+		status := ZoneStatus{Name: name, Occupied: z.occupied(now), Hold: z.hold.String(), Level: t.level(z, now)}
+		if status.Occupied && !z.held {
+			until := z.release.Add(z.hold)
+			status.Until = &until
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+//ReadSignals reads lines like "bathroom motion" or "hallway vacant" from a sensor, until r ends.  It stands in for
+//sensors on GPIO or a serial port, with a small script or microcontroller writing a line for each change.
+//A line with just a zone name is motion.  Bad lines are passed to report and skipped.
+func (t *Tracker) ReadSignals(r io.Reader, now func() time.Time, report func(line string, err error)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		signal := Motion
+		if len(fields) > 1 {
+			var err error
+			if signal, err = ParseSignal([]byte(fields[1])); err != nil {
+				report(scanner.Text(), err)
+				continue
+			}
+		}
+		if err := t.Signal(fields[0], signal, now()); err != nil {
+			report(scanner.Text(), err)
+		}
+	}
+	return scanner.Err()
+}
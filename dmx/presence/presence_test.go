@@ -0,0 +1,113 @@
+package presence_test
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	. "github.com/rltvty/go-home/dmx/presence"
+)
+
+var _ = Describe("Presence", func() {
+	now := time.Date(2019, 6, 21, 22, 0, 0, 0, time.UTC)
+	var tracker *Tracker
+
+	BeforeEach(func() {
+		tracker = New(map[string]time.Duration{"bathroom": 5 * time.Minute, "hallway": time.Minute})
+	})
+
+	It("should start every zone vacant", func() {
+		Expect(tracker.Level("bathroom", now)).To(Equal(0.1))
+		Expect(tracker.Status(now)[0].Occupied).To(BeFalse())
+	})
+
+	It("should leave zones it doesn't track at full", func() {
+		Expect(tracker.Level("kitchen", now)).To(Equal(1.0))
+		Expect(tracker.Signal("kitchen", Motion, now)).To(MatchError("Unknown zone: kitchen"))
+	})
+
+	It("should brighten on motion and dim after the hold time", func() {
+		Expect(tracker.Signal("bathroom", Motion, now)).To(Succeed())
+		Expect(tracker.Level("bathroom", now.Add(500*time.Millisecond))).To(BeNumerically("~", 0.55, 0.001))
+		Expect(tracker.Level("bathroom", now.Add(time.Second))).To(Equal(1.0))
+		Expect(tracker.Level("bathroom", now.Add(5*time.Minute-time.Second))).To(Equal(1.0))
+		Expect(tracker.Level("bathroom", now.Add(5*time.Minute+30*time.Second))).To(BeNumerically("~", 0.55, 0.001))
+		Expect(tracker.Level("bathroom", now.Add(6*time.Minute))).To(Equal(0.1))
+	})
+
+	It("should restart the hold time on more motion", func() {
+		tracker.Signal("hallway", Motion, now)
+		tracker.Signal("hallway", Motion, now.Add(50*time.Second))
+		Expect(tracker.Level("hallway", now.Add(100*time.Second))).To(Equal(1.0))
+		Expect(tracker.Level("hallway", now.Add(120*time.Second))).To(BeNumerically("<", 1))
+	})
+
+	It("should brighten from where it had dimmed to", func() {
+		tracker.Signal("hallway", Motion, now)
+		dimming := now.Add(90 * time.Second)
+		Expect(tracker.Level("hallway", dimming)).To(BeNumerically("~", 0.55, 0.001))
+		tracker.Signal("hallway", Motion, dimming)
+		Expect(tracker.Level("hallway", dimming)).To(BeNumerically("~", 0.55, 0.001))
+		Expect(tracker.Level("hallway", dimming.Add(500*time.Millisecond))).To(BeNumerically("~", 0.775, 0.001))
+	})
+
+	It("should stay occupied while a sensor reports it, then hold", func() {
+		tracker.Signal("hallway", Occupied, now)
+		Expect(tracker.Level("hallway", now.Add(time.Hour))).To(Equal(1.0))
+		status := tracker.Status(now.Add(time.Hour))
+		Expect(status[1].Occupied).To(BeTrue())
+		Expect(status[1].Until).To(BeNil())
+
+		tracker.Signal("hallway", Vacant, now.Add(time.Hour))
+		status = tracker.Status(now.Add(time.Hour))
+		Expect(status[1].Until).To(Equal(&[]time.Time{now.Add(time.Hour + time.Minute)}[0]))
+		Expect(tracker.Level("hallway", now.Add(time.Hour+2*time.Minute))).To(Equal(0.1))
+	})
+
+	It("should not cut the hold time short when a motion sensor clears", func() {
+		tracker.Signal("bathroom", Motion, now)
+		tracker.Signal("bathroom", Vacant, now.Add(time.Second))
+		Expect(tracker.Status(now.Add(4 * time.Minute))[0].Occupied).To(BeTrue())
+	})
+
+	DescribeTable("ParseSignal",
+		func(payload string, signal Signal) {
+			Expect(ParseSignal([]byte(payload))).To(Equal(signal))
+		},
+		Entry("an empty payload", "", Motion),
+		Entry("motion", "motion", Motion),
+		Entry("on", "ON", Occupied),
+		Entry("false", "false", Vacant),
+		Entry("zigbee2mqtt", `{"occupancy": true, "battery": 90}`, Occupied),
+	)
+
+	It("should reject unknown signals", func() {
+		_, err := ParseSignal([]byte("maybe"))
+		Expect(err).To(MatchError("Unknown presence signal: maybe"))
+		_, err = ParseSignal([]byte(`{"battery": 90}`))
+		Expect(err).To(MatchError("Presence message has no occupancy"))
+	})
+
+	It("should parse zones with hold times", func() {
+		Expect(ParseZones("bathroom=5m, hallway")).To(Equal(map[string]time.Duration{
+			"bathroom": 5 * time.Minute,
+			"hallway":  5 * time.Minute,
+		}))
+		_, err := ParseZones("bathroom=soon")
+		Expect(err).To(MatchError("Invalid hold time: bathroom=soon"))
+	})
+
+	It("should read signals a line at a time", func() {
+		var bad []string
+		err := tracker.ReadSignals(strings.NewReader("bathroom motion\n\nhallway on\nkitchen\nhallway maybe\n"),
+			func() time.Time { return now },
+			func(line string, err error) { bad = append(bad, line) })
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bad).To(Equal([]string{"kitchen", "hallway maybe"}))
+		Expect(tracker.Status(now.Add(time.Hour))[1].Occupied).To(BeTrue())
+		Expect(tracker.Status(now)[0].Occupied).To(BeTrue())
+	})
+})
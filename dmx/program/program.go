@@ -0,0 +1,194 @@
+package program
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rltvty/go-home/dmx/astronomy"
+	"github.com/rltvty/go-home/dmx/default_loop"
+)
+
+//anchors maps the event names usable in a cue's "at" to the event time
+var anchors = map[string]func(e astronomy.Events) time.Time{
+	"astronomical-dawn":   func(e astronomy.Events) time.Time { return e.AstronomicalDawn },
+	"nautical-dawn":       func(e astronomy.Events) time.Time { return e.NauticalDawn },
+	"morning-blue-hour":   func(e astronomy.Events) time.Time { return e.MorningBlueHour.Start },
+	"dawn":                func(e astronomy.Events) time.Time { return e.Dawn },
+	"morning-golden-hour": func(e astronomy.Events) time.Time { return e.MorningGoldenHour.Start },
+	"sunrise":             func(e astronomy.Events) time.Time { return e.SunRise },
+	"noon":                func(e astronomy.Events) time.Time { return e.SunPeak },
+	"evening-golden-hour": func(e astronomy.Events) time.Time { return e.EveningGoldenHour.Start },
+	"sunset":              func(e astronomy.Events) time.Time { return e.SunSet },
+	"evening-blue-hour":   func(e astronomy.Events) time.Time { return e.EveningBlueHour.Start },
+	"dusk":                func(e astronomy.Events) time.Time { return e.Dusk },
+	"nautical-dusk":       func(e astronomy.Events) time.Time { return e.NauticalDusk },
+	"astronomical-dusk":   func(e astronomy.Events) time.Time { return e.AstronomicalDusk },
+}
+
+var clockPattern = regexp.MustCompile(`^(\d{1,2}):(\d{2})`)
+
+//CueJSON intermediate type for parsing a cue
+type CueJSON struct {
+	//At is an event or clock time with an optional offset, like "dawn-60m", "sunset+15m" or "22:30"
+	At     string             `json:"at"`
+	Name   string             `json:"name"`
+	Color  default_loop.Color `json:"color"`
+	Fade   string             `json:"fade"`
+	Easing string             `json:"easing"`
+}
+
+//ProgramJSON intermediate type for parsing a program
+type ProgramJSON struct {
+	Name string    `json:"name"`
+	Cues []CueJSON `json:"cues"`
+}
+
+//anchor is a point in the day, either an astronomical event or a clock time, plus an offset
+type anchor struct {
+	event  string
+	clock  time.Duration
+	offset time.Duration
+}
+
+type cue struct {
+	at     anchor
+	name   string
+	color  default_loop.Color
+	fade   time.Duration
+	easing default_loop.Easing
+}
+
+//Program is a parsed lighting program
+type Program struct {
+	Name string
+	cues []cue
+}
+
+//ParseJSON parses a program definition
+func ParseJSON(jsonData []byte) (*Program, error) {
+	var definition ProgramJSON
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&definition); err != nil {
+		return nil, err
+	}
+	if len(definition.Cues) == 0 {
+		return nil, fmt.Errorf("Program %s has no cues", definition.Name)
+	}
+
+	program := Program{Name: definition.Name}
+	for i, jsonCue := range definition.Cues {
+		at, err := parseAnchor(jsonCue.At)
+		if err != nil {
+			return nil, fmt.Errorf("Cue %d: %s", i, err)
+		}
+		var fade time.Duration
+		if jsonCue.Fade != "" {
+			fade, err = time.ParseDuration(jsonCue.Fade)
+			if err != nil || fade < 0 {
+				return nil, fmt.Errorf("Cue %d: invalid fade: %s", i, jsonCue.Fade)
+			}
+		}
+		easing, err := default_loop.ParseEasing(jsonCue.Easing)
+		if err != nil {
+			return nil, fmt.Errorf("Cue %d: %s", i, err)
+		}
+		name := jsonCue.Name
+		if name == "" {
+			name = jsonCue.At
+		}
+		program.cues = append(program.cues, cue{at: *at, name: name, color: jsonCue.Color, fade: fade, easing: easing})
+	}
+	return &program, nil
+}
+
+//Load reads and parses a program definition file
+func Load(path string) (*Program, error) {
+	jsonData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJSON(jsonData)
+}
+
+func parseAnchor(text string) (*anchor, error) {
+	var at anchor
+	rest := text
+	if match := clockPattern.FindStringSubmatch(text); match != nil {
+		hours, _ := strconv.Atoi(match[1])
+		minutes, _ := strconv.Atoi(match[2])
+		if hours > 23 || minutes > 59 {
+			return nil, fmt.Errorf("invalid clock time: %s", text)
+		}
+		at.clock = time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+		rest = text[len(match[0]):]
+	} else {
+		//longest names first, so "nautical-dawn" isn't read as "dawn"
+		names := make([]string, 0, len(anchors))
+		for name := range anchors {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+		for _, name := range names {
+			if strings.HasPrefix(text, name) {
+				at.event = name
+				rest = text[len(name):]
+				break
+			}
+		}
+		if at.event == "" {
+			return nil, fmt.Errorf("unknown event: %s", text)
+		}
+	}
+
+	if rest != "" {
+		if rest[0] != '+' && rest[0] != '-' {
+			return nil, fmt.Errorf("invalid offset in %s", text)
+		}
+		offset, err := time.ParseDuration(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset in %s", text)
+		}
+		at.offset = offset
+	}
+	return &at, nil
+}
+
+//resolve finds the time of the anchor on day, false if the event doesn't happen that day
+func (a anchor) resolve(day astronomy.Day) (time.Time, bool) {
+	if a.event == "" {
+		return default_loop.ClockOn(day.Date, a.clock).Add(a.offset), true
+	}
+	t := anchors[a.event](day.Events)
+	if t.IsZero() {
+		return t, false
+	}
+	return t.Add(a.offset), true
+}
+
+//Cues resolves the program's cues on each day, so cues from the day before carry past midnight
+func (p *Program) Cues(days []astronomy.Day) []default_loop.Cue {
+	cues := []default_loop.Cue{}
+	for _, day := range days {
+		for _, c := range p.cues {
+			at, ok := c.at.resolve(day)
+			if !ok {
+				continue
+			}
+			cues = append(cues, default_loop.Cue{Name: c.name, At: at, Color: c.color, Fade: c.fade, Easing: c.easing})
+		}
+	}
+	return cues
+}
+
+//Evaluate returns the color the program has at now, and the name of the active cue
+func (p *Program) Evaluate(now time.Time, days []astronomy.Day) (default_loop.Color, string) {
+	return default_loop.Evaluate(now, p.Cues(days))
+}
@@ -0,0 +1,13 @@
+package program_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestProgram(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Program Suite")
+}
@@ -0,0 +1,253 @@
+package program_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/rltvty/go-home/dmx/astronomy"
+	"github.com/rltvty/go-home/dmx/default_loop"
+	. "github.com/rltvty/go-home/dmx/program"
+)
+
+func localTime(hour int, minute int) time.Time {
+	return time.Date(2019, 6, 1, hour, minute, 0, 0, time.Local)
+}
+
+//daysAround repeats events on the days either side of 2019-06-01
+func daysAround(events astronomy.Events) []astronomy.Day {
+	days := []astronomy.Day{}
+	for offset := -1; offset <= 1; offset++ {
+		days = append(days, astronomy.Day{Date: localTime(0, 0).AddDate(0, 0, offset), Events: *events.AddDays(offset)})
+	}
+	return days
+}
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+var _ = Describe("Program", func() {
+	events := astronomy.Events{
+		Dawn:             localTime(6, 0),
+		SunRise:          localTime(6, 30),
+		SunPeak:          localTime(13, 30),
+		SunSet:           localTime(20, 30),
+		Dusk:             localTime(21, 0),
+		AstronomicalDusk: time.Time{},
+	}
+	programJSON := `{
+		"name": "test",
+		"cues": [
+			{"at": "dawn-60m", "color": {"red": 100}, "fade": "60m"},
+			{"at": "sunrise", "name": "day", "color": {"white": 200}, "fade": "10m", "easing": "linear"},
+			{"at": "sunset+15m", "name": "evening", "color": {"red": 200}},
+			{"at": "astronomical-dusk", "name": "never", "color": {"uv": 200}},
+			{"at": "22:30", "name": "night", "color": {"red": 20}, "fade": "30m"}
+		]
+	}`
+
+	Describe("ParseJSON", func() {
+		It("should parse a valid program", func() {
+			program, err := ParseJSON([]byte(programJSON))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(program.Name).To(Equal("test"))
+		})
+
+		It("should parse the bundled programs", func() {
+			paths, _ := filepath.Glob("../programs/*.json")
+			for _, path := range paths {
+				if filepath.Base(path) == "schedule.json" {
+					continue
+				}
+				_, err := Load(path)
+				Expect(err).NotTo(HaveOccurred(), path)
+			}
+		})
+
+		DescribeTable("rejecting invalid cues",
+			func(cueJSON string, message string) {
+				_, err := ParseJSON([]byte(`{"name": "bad", "cues": [` + cueJSON + `]}`))
+				Expect(err).To(MatchError(message))
+			},
+			Entry("unknown event", `{"at": "teatime"}`, "Cue 0: unknown event: teatime"),
+			Entry("bad offset", `{"at": "dawn*2"}`, "Cue 0: invalid offset in dawn*2"),
+			Entry("bad clock", `{"at": "25:00"}`, "Cue 0: invalid clock time: 25:00"),
+			Entry("bad fade", `{"at": "dawn", "fade": "soon"}`, "Cue 0: invalid fade: soon"),
+			Entry("bad easing", `{"at": "dawn", "easing": "bouncy"}`, "Cue 0: Unknown easing: bouncy"),
+		)
+
+		It("should reject programs without cues", func() {
+			_, err := ParseJSON([]byte(`{"name": "empty", "cues": []}`))
+			Expect(err).To(MatchError("Program empty has no cues"))
+		})
+	})
+
+	Describe("Evaluate", func() {
+		var program *Program
+		var days []astronomy.Day
+
+		BeforeEach(func() {
+			program, _ = ParseJSON([]byte(programJSON))
+			days = daysAround(events)
+		})
+
+		It("should carry yesterday's last cue past midnight", func() {
+			color, name := program.Evaluate(localTime(2, 0), days)
+			Expect(name).To(Equal("night"))
+			Expect(color).To(Equal(default_loop.Color{Red: 20}))
+		})
+
+		It("should name cues after their anchor by default", func() {
+			color, name := program.Evaluate(localTime(5, 30), days)
+			Expect(name).To(Equal("dawn-60m"))
+			Expect(color).To(Equal(default_loop.Color{Red: 60}))
+		})
+
+		It("should interpolate between cues", func() {
+			color, name := program.Evaluate(localTime(6, 35), days)
+			Expect(name).To(Equal("day"))
+			Expect(color).To(Equal(default_loop.Color{Red: 50, White: 100}))
+		})
+
+		It("should apply offsets", func() {
+			_, name := program.Evaluate(localTime(20, 40), days)
+			Expect(name).To(Equal("day"))
+			_, name = program.Evaluate(localTime(20, 45), days)
+			Expect(name).To(Equal("evening"))
+		})
+
+		It("should skip events that don't happen", func() {
+			_, name := program.Evaluate(localTime(22, 0), days)
+			Expect(name).To(Equal("evening"))
+		})
+
+		Context("when an event falls after midnight", func() {
+			helsinki := mustLoadLocation("Europe/Helsinki")
+			calculator := astronomy.NewCalculator(func(c *astronomy.Calculator) {
+				c.Latitude = 60.17
+				c.Longitude = 24.94
+				c.Location = helsinki
+			})
+			late, _ := ParseJSON([]byte(`{"name": "late", "cues": [
+				{"at": "dusk", "name": "dusk", "color": {"red": 100}},
+				{"at": "nautical-dusk", "name": "nautical", "color": {"red": 50}}
+			]}`))
+			at := func(month time.Month, day int, hour int, minute int) string {
+				now := time.Date(2019, month, day, hour, minute, 0, 0, helsinki)
+				days, err := astronomy.DaysAround(now, calculator.GetEventsFor)
+				Expect(err).NotTo(HaveOccurred())
+				_, name := late.Evaluate(now, days)
+				return name
+			}
+
+			//nautical dusk on 2019-05-08 is at 00:27 on the 9th, and doesn't happen from the 11th
+			It("should place it on the following morning", func() {
+				Expect(at(5, 8, 23, 59)).To(Equal("dusk"))
+				Expect(at(5, 9, 0, 20)).To(Equal("dusk"))
+				Expect(at(5, 9, 0, 30)).To(Equal("nautical"))
+				Expect(at(5, 9, 12, 0)).To(Equal("nautical"))
+			})
+
+			It("should skip it once it stops happening", func() {
+				Expect(at(5, 12, 1, 0)).To(Equal("dusk"))
+			})
+		})
+
+		Context("on DST change days", func() {
+			chicago := mustLoadLocation("America/Chicago")
+			calculator := astronomy.NewCalculator(func(c *astronomy.Calculator) {
+				c.Location = chicago
+			})
+			clock, _ := ParseJSON([]byte(`{"name": "clock", "cues": [
+				{"at": "00:00", "name": "midnight", "color": {}},
+				{"at": "01:30", "name": "fade", "color": {"red": 200}, "fade": "60m", "easing": "linear"},
+				{"at": "02:30", "name": "skipped hour", "color": {"blue": 200}},
+				{"at": "sunrise", "name": "sunrise", "color": {"white": 200}}
+			]}`))
+			evaluate := func(now time.Time) (default_loop.Color, string) {
+				days, err := astronomy.DaysAround(now, calculator.GetEventsFor)
+				Expect(err).NotTo(HaveOccurred())
+				return clock.Evaluate(now, days)
+			}
+
+			It("should fade over elapsed time when the clocks go forward", func() {
+				//01:30 CST to 03:00 CDT is 30 minutes
+				color, name := evaluate(time.Date(2019, 3, 10, 3, 0, 0, 0, chicago))
+				Expect(name).To(Equal("fade"))
+				Expect(color).To(Equal(default_loop.Color{Red: 100}))
+			})
+
+			It("should move clock times in the skipped hour forward", func() {
+				_, name := evaluate(time.Date(2019, 3, 10, 3, 20, 0, 0, chicago))
+				Expect(name).To(Equal("fade"))
+				_, name = evaluate(time.Date(2019, 3, 10, 3, 30, 0, 0, chicago))
+				Expect(name).To(Equal("skipped hour"))
+			})
+
+			It("should use the events of the day, not the day before", func() {
+				//sunrise is 06:48 CST on the 9th and 07:47 CDT on the 10th
+				_, name := evaluate(time.Date(2019, 3, 10, 7, 40, 0, 0, chicago))
+				Expect(name).To(Equal("skipped hour"))
+				_, name = evaluate(time.Date(2019, 3, 10, 7, 50, 0, 0, chicago))
+				Expect(name).To(Equal("sunrise"))
+				//and 06:47 CST on 2019-11-03, when the clocks go back
+				_, name = evaluate(time.Date(2019, 11, 3, 6, 40, 0, 0, chicago))
+				Expect(name).To(Equal("skipped hour"))
+				_, name = evaluate(time.Date(2019, 11, 3, 6, 50, 0, 0, chicago))
+				Expect(name).To(Equal("sunrise"))
+			})
+		})
+	})
+
+	Describe("Watcher", func() {
+		var dir string
+		var path string
+
+		BeforeEach(func() {
+			dir, _ = ioutil.TempDir("", "program")
+			path = filepath.Join(dir, "program.json")
+			ioutil.WriteFile(path, []byte(programJSON), 0644)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("should reload the program when the file changes", func() {
+			watcher, err := NewWatcher(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(watcher.Program().Name).To(Equal("test"))
+
+			ioutil.WriteFile(path, []byte(`{"name": "changed", "cues": [{"at": "noon"}]}`), 0644)
+			os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+			reloaded, err := watcher.Reload()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reloaded).To(BeTrue())
+			Expect(watcher.Program().Name).To(Equal("changed"))
+		})
+
+		It("should keep the previous program when the new one is invalid", func() {
+			watcher, _ := NewWatcher(path)
+			ioutil.WriteFile(path, []byte(`{"name": "broken"`), 0644)
+			os.Chtimes(path, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+			_, err := watcher.Reload()
+			Expect(err).To(HaveOccurred())
+			Expect(watcher.Program().Name).To(Equal("test"))
+		})
+
+		It("should not reload an unchanged file", func() {
+			watcher, _ := NewWatcher(path)
+			Expect(watcher.Reload()).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,83 @@
+package program
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rltvty/go-home/logwrapper"
+	"go.uber.org/zap"
+)
+
+//Watcher keeps a program loaded from a file, reloading it when the file changes
+type Watcher struct {
+	Path string
+
+	mu      sync.RWMutex
+	program *Program
+	modTime time.Time
+}
+
+//NewWatcher loads the program at path
+func NewWatcher(path string) (*Watcher, error) {
+	watcher := Watcher{Path: path}
+	if _, err := watcher.Reload(); err != nil {
+		return nil, err
+	}
+	return &watcher, nil
+}
+
+//Program returns the most recently loaded program
+func (w *Watcher) Program() *Program {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.program
+}
+
+//Reload loads the file if it changed since the last load, returning whether it did.
+//A file that fails to parse leaves the previous program in place.
+func (w *Watcher) Reload() (bool, error) {
+	info, err := os.Stat(w.Path)
+	if err != nil {
+		return false, err
+	}
+
+	w.mu.RLock()
+	unchanged := w.program != nil && info.ModTime().Equal(w.modTime)
+	w.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	program, err := Load(w.Path)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	//don't retry a broken file until it changes again
+	w.modTime = info.ModTime()
+	if err != nil {
+		return false, err
+	}
+	w.program = program
+	return true, nil
+}
+
+//Watch checks the file for changes every interval until quit receives
+func (w *Watcher) Watch(interval time.Duration, quit chan int) {
+	log := logwrapper.GetInstance()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, err := w.Reload()
+			if err != nil {
+				log.InfoError("Unable to reload program, keeping the previous one", err)
+			} else if reloaded {
+				log.Info("Reloaded program", zap.String("path", w.Path), zap.String("name", w.Program().Name))
+			}
+		case <-quit:
+			log.Info("Watch received quit request, exiting...")
+			return
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package simulate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/rltvty/go-home/dmx/output"
+)
+
+//Recorder writes every universe frame to a file
+type Recorder interface {
+	//Record writes the frame of each universe at now
+	Record(now time.Time, frames []output.Frame) error
+	Close() error
+}
+
+//CSVRecorder writes a row for each universe in each frame: the time, the universe and its channel levels
+type CSVRecorder struct {
+	w         io.WriteCloser
+	buf       *bufio.Writer
+	universes []uint16
+	channels  int
+}
+
+//NewCSVRecorder writes the first channels of each of universes to w, starting with a header row
+func NewCSVRecorder(w io.WriteCloser, universes []uint16, channels int) (*CSVRecorder, error) {
+	r := CSVRecorder{w: w, buf: bufio.NewWriter(w), universes: universes, channels: channels}
+	r.buf.WriteString("time,universe")
+	for i := 1; i <= channels; i++ {
+		fmt.Fprintf(r.buf, ",%d", i)
+	}
+	_, err := r.buf.WriteString("\n")
+	return &r, err
+}
+
+//Record writes a row for each universe
+func (r *CSVRecorder) Record(now time.Time, frames []output.Frame) error {
+	for i, frame := range frames {
+		r.buf.WriteString(now.Format(time.RFC3339Nano))
+		r.buf.WriteString(",")
+		r.buf.WriteString(strconv.Itoa(int(r.universes[i])))
+		for _, level := range frame[:r.channels] {
+			r.buf.WriteString(",")
+			r.buf.WriteString(strconv.Itoa(int(level)))
+		}
+		if _, err := r.buf.WriteString("\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Close flushes and closes the file
+func (r *CSVRecorder) Close() error {
+	if err := r.buf.Flush(); err != nil {
+		r.w.Close()
+		return err
+	}
+	return r.w.Close()
+}
+
+//frameJSON is one universe's frame in a JSON recording
+type frameJSON struct {
+	Time     time.Time `json:"time"`
+	Universe uint16    `json:"universe"`
+	Data     []int     `json:"data"`
+}
+
+//JSONRecorder writes a JSON array of frames, each with the time, universe and channel levels
+type JSONRecorder struct {
+	w         io.WriteCloser
+	buf       *bufio.Writer
+	universes []uint16
+	channels  int
+	written   bool
+}
+
+//NewJSONRecorder writes the first channels of each of universes to w
+func NewJSONRecorder(w io.WriteCloser, universes []uint16, channels int) (*JSONRecorder, error) {
+	r := JSONRecorder{w: w, buf: bufio.NewWriter(w), universes: universes, channels: channels}
+	_, err := r.buf.WriteString("[")
+	return &r, err
+}
+
+//Record writes an object for each universe
+func (r *JSONRecorder) Record(now time.Time, frames []output.Frame) error {
+	for i, frame := range frames {
+		data := make([]int, r.channels)
+		for channel := range data {
+			data[channel] = int(frame[channel])
+		}
+		b, err := json.Marshal(frameJSON{Time: now, Universe: r.universes[i], Data: data})
+		if err != nil {
+			return err
+		}
+		if r.written {
+			r.buf.WriteString(",")
+		}
+		r.written = true
+		r.buf.WriteString("\n")
+		if _, err := r.buf.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Close ends the array, then flushes and closes the file
+func (r *JSONRecorder) Close() error {
+	r.buf.WriteString("\n]\n")
+	if err := r.buf.Flush(); err != nil {
+		r.w.Close()
+		return err
+	}
+	return r.w.Close()
+}
+
+//NewRecorder creates a file at path, recording as CSV or JSON depending on its extension
+func NewRecorder(path string, universes []uint16, channels int) (Recorder, error) {
+	ext := filepath.Ext(path)
+	if ext != ".csv" && ext != ".json" {
+		return nil, fmt.Errorf("Unknown recording format: %s", ext)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if ext == ".csv" {
+		return NewCSVRecorder(f, universes, channels)
+	}
+	return NewJSONRecorder(f, universes, channels)
+}
@@ -0,0 +1,46 @@
+package simulate
+
+import (
+	"time"
+)
+
+const defaultStep = time.Second
+
+//Simulator runs the lighting pipeline over simulated time as fast as it can, so a day can be checked without
+//waiting for it, or standing next to the fixtures
+type Simulator struct {
+	Start time.Time
+	//End is when the simulation stops, by default a day after Start, which is 23 or 25 hours on DST change days
+	End time.Time
+	//Step is how far simulated time moves between frames
+	Step time.Duration
+}
+
+//New creates a simulator of the day from start, with optional options
+func New(start time.Time, options ...func(*Simulator)) *Simulator {
+	simulator := Simulator{
+		Start: start,
+		End:   start.AddDate(0, 0, 1),
+		Step:  defaultStep,
+	}
+	simulator.SetOptions(options...)
+
+	return &simulator
+}
+
+// SetOptions takes one or more option function and applies them in order to Simulator.
+func (s *Simulator) SetOptions(options ...func(*Simulator)) {
+	for _, opt := range options {
+		opt(s)
+	}
+}
+
+//Run calls frame at each simulated time from Start up to End, stopping at the first error
+func (s *Simulator) Run(frame func(now time.Time) error) error {
+	for now := s.Start; now.Before(s.End); now = now.Add(s.Step) {
+		if err := frame(now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
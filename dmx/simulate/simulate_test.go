@@ -0,0 +1,158 @@
+package simulate_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rltvty/go-home/dmx/default_loop"
+	"github.com/rltvty/go-home/dmx/output"
+	. "github.com/rltvty/go-home/dmx/simulate"
+)
+
+//buffer is a bytes.Buffer that can be closed
+type buffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *buffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+var _ = Describe("Simulate", func() {
+	start := time.Date(2019, 6, 21, 0, 0, 0, 0, time.UTC)
+
+	Describe("Simulator", func() {
+		It("should step through the day", func() {
+			var times []time.Time
+			Expect(New(start, func(s *Simulator) { s.Step = time.Hour }).Run(func(now time.Time) error {
+				times = append(times, now)
+				return nil
+			})).To(Succeed())
+			Expect(times).To(HaveLen(24))
+			Expect(times[23]).To(Equal(start.Add(23 * time.Hour)))
+		})
+
+		It("should simulate the whole of a DST change day", func() {
+			chicago, err := time.LoadLocation("America/Chicago")
+			Expect(err).NotTo(HaveOccurred())
+			frames := 0
+			New(time.Date(2019, 11, 3, 0, 0, 0, 0, chicago), func(s *Simulator) { s.Step = time.Hour }).Run(func(now time.Time) error {
+				frames++
+				return nil
+			})
+			Expect(frames).To(Equal(25))
+		})
+
+		It("should stop at the first error", func() {
+			frames := 0
+			err := New(start).Run(func(now time.Time) error {
+				frames++
+				if frames == 3 {
+					return errors.New("Disk full")
+				}
+				return nil
+			})
+			Expect(err).To(MatchError("Disk full"))
+			Expect(frames).To(Equal(3))
+		})
+	})
+
+	Describe("Recorders", func() {
+		frames := []output.Frame{{1, 2, 3, 4}, {5, 6, 7, 8}}
+
+		It("should write CSV rows for each universe", func() {
+			w := &buffer{}
+			recorder, err := NewCSVRecorder(w, []uint16{1, 0}, 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Record(start, frames)).To(Succeed())
+			Expect(recorder.Close()).To(Succeed())
+			Expect(w.closed).To(BeTrue())
+			Expect(w.String()).To(Equal("time,universe,1,2,3\n" +
+				"2019-06-21T00:00:00Z,1,1,2,3\n" +
+				"2019-06-21T00:00:00Z,0,5,6,7\n"))
+		})
+
+		It("should write a JSON array of frames", func() {
+			w := &buffer{}
+			recorder, err := NewJSONRecorder(w, []uint16{1, 0}, 2)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recorder.Record(start, frames)).To(Succeed())
+			Expect(recorder.Record(start.Add(time.Second), frames)).To(Succeed())
+			Expect(recorder.Close()).To(Succeed())
+
+			var recorded []struct {
+				Time     time.Time
+				Universe uint16
+				Data     []int
+			}
+			Expect(json.Unmarshal(w.Bytes(), &recorded)).To(Succeed())
+			Expect(recorded).To(HaveLen(4))
+			Expect(recorded[3].Time).To(Equal(start.Add(time.Second)))
+			Expect(recorded[3].Universe).To(Equal(uint16(0)))
+			Expect(recorded[3].Data).To(Equal([]int{5, 6}))
+		})
+
+		It("should reject unknown formats", func() {
+			_, err := NewRecorder("day.pcap", []uint16{1}, 7)
+			Expect(err).To(MatchError("Unknown recording format: .pcap"))
+		})
+	})
+
+	Describe("Timeline", func() {
+		red := default_loop.Color{Red: 255}
+		var timeline *Timeline
+
+		BeforeEach(func() {
+			timeline = NewTimeline([]string{"sink", "shower"})
+			for i := 0; i < 180; i++ {
+				now := start.Add(time.Duration(i) * 20 * time.Second)
+				program := "night"
+				if i >= 90 {
+					program = "dawn"
+				}
+				timeline.Add(now, []default_loop.Color{red, {Blue: byte(i / 3)}}, program)
+			}
+		})
+
+		It("should draw a rect for each stretch of a color, and for each program", func() {
+			var svg bytes.Buffer
+			Expect(timeline.WriteSVG(&svg)).To(Succeed())
+			Expect(svg.String()).To(HavePrefix(`<svg xmlns="http://www.w3.org/2000/svg" width="140" height="120"`))
+			//the sink is red all along, the shower changes every minute
+			Expect(strings.Count(svg.String(), `fill="#ff0000"`)).To(Equal(1))
+			Expect(strings.Count(svg.String(), "<rect")).To(Equal(2 + 1 + 60))
+			Expect(svg.String()).To(ContainSubstring("<title>00:30 dawn</title>"))
+		})
+
+		It("should list the programs in the HTML", func() {
+			var page bytes.Buffer
+			Expect(timeline.WriteHTML(&page)).To(Succeed())
+			Expect(page.String()).To(ContainSubstring("<h1>Timeline for Friday 21 June 2019</h1>"))
+			Expect(page.String()).To(ContainSubstring("<tr><td>00:30</td><td>dawn</td></tr>"))
+		})
+
+		It("should draw a PNG strip for each fixture", func() {
+			var b bytes.Buffer
+			Expect(timeline.WritePNG(&b)).To(Succeed())
+			img, err := png.Decode(&b)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(img.Bounds().Dx()).To(Equal(60))
+			Expect(img.Bounds().Dy()).To(Equal(80))
+			r, g, b2, _ := img.At(10, 10).RGBA()
+			Expect([]uint32{r >> 8, g >> 8, b2 >> 8}).To(Equal([]uint32{255, 0, 0}))
+		})
+
+		It("should reject unknown formats", func() {
+			Expect(timeline.Save("day.gif")).To(MatchError("Unknown timeline format: .gif"))
+		})
+	})
+})
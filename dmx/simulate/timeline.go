@@ -0,0 +1,190 @@
+package simulate
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rltvty/go-home/dmx/default_loop"
+)
+
+const defaultInterval = time.Minute
+
+//timeline layout, in pixels, with one pixel across for each sample
+const (
+	labelWidth   = 80
+	rowHeight    = 40
+	programRow   = 20
+	axisHeight   = 20
+	programLabel = 60
+)
+
+type sample struct {
+	time    time.Time
+	colors  []default_loop.Color
+	program string
+}
+
+//Timeline collects the colors of each fixture over a simulation, and draws them as a strip per fixture
+type Timeline struct {
+	//Interval is how often a sample is kept
+	Interval time.Duration
+	Fixtures []string
+	samples  []sample
+}
+
+//NewTimeline creates an empty timeline of the named fixtures, with optional options
+func NewTimeline(fixtures []string, options ...func(*Timeline)) *Timeline {
+	timeline := Timeline{
+		Interval: defaultInterval,
+		Fixtures: fixtures,
+	}
+	timeline.SetOptions(options...)
+
+	return &timeline
+}
+
+// SetOptions takes one or more option function and applies them in order to Timeline.
+func (t *Timeline) SetOptions(options ...func(*Timeline)) {
+	for _, opt := range options {
+		opt(t)
+	}
+}
+
+//Add records the fixture colors and program at now, if an interval has passed since the last sample kept
+func (t *Timeline) Add(now time.Time, colors []default_loop.Color, program string) {
+	if len(t.samples) > 0 && now.Sub(t.samples[len(t.samples)-1].time) < t.Interval {
+		return
+	}
+	t.samples = append(t.samples, sample{time: now, colors: append([]default_loop.Color{}, colors...), program: program})
+}
+
+//run is a stretch of samples with the same value
+type run struct {
+	start int
+	end   int
+}
+
+//runs splits the samples into stretches where key doesn't change
+func (t *Timeline) runs(key func(s sample) interface{}) []run {
+	var runs []run
+	for i, s := range t.samples {
+		if len(runs) > 0 && key(t.samples[runs[len(runs)-1].start]) == key(s) {
+			runs[len(runs)-1].end = i + 1
+			continue
+		}
+		runs = append(runs, run{start: i, end: i + 1})
+	}
+	return runs
+}
+
+func svgColor(c default_loop.Color) string {
+	r, g, b := default_loop.SRGB(c)
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+//WriteSVG draws the program as a band along the top, then a strip for each fixture, with an hour axis below
+func (t *Timeline) WriteSVG(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	width := labelWidth + len(t.samples)
+	height := programRow + rowHeight*len(t.Fixtures) + axisHeight
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`+"\n", width, height)
+
+	for i, r := range t.runs(func(s sample) interface{} { return s.program }) {
+		program := html.EscapeString(t.samples[r.start].program)
+		fill := "#ddd"
+		if i%2 == 1 {
+			fill = "#bbb"
+		}
+		fmt.Fprintf(buf, `<rect x="%d" y="0" width="%d" height="%d" fill="%s"><title>%s %s</title></rect>`+"\n",
+			labelWidth+r.start, r.end-r.start, programRow, fill, t.samples[r.start].time.Format("15:04"), program)
+		if r.end-r.start >= programLabel {
+			fmt.Fprintf(buf, `<text x="%d" y="14">%s</text>`+"\n", labelWidth+r.start+2, program)
+		}
+	}
+
+	for f, name := range t.Fixtures {
+		y := programRow + f*rowHeight
+		fmt.Fprintf(buf, `<text x="4" y="%d">%s</text>`+"\n", y+rowHeight/2+4, html.EscapeString(name))
+		for _, r := range t.runs(func(s sample) interface{} { return s.colors[f] }) {
+			c := t.samples[r.start].colors[f]
+			fmt.Fprintf(buf, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"><title>%s %s</title></rect>`+"\n",
+				labelWidth+r.start, y, r.end-r.start, rowHeight, svgColor(c), t.samples[r.start].time.Format("15:04"), c)
+		}
+	}
+
+	axis := programRow + rowHeight*len(t.Fixtures)
+	for i, s := range t.samples {
+		if i > 0 && s.time.Hour() == t.samples[i-1].time.Hour() {
+			continue
+		}
+		fmt.Fprintf(buf, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#000"/><text x="%d" y="%d">%s</text>`+"\n",
+			labelWidth+i, axis, labelWidth+i, axis+4, labelWidth+i+2, axis+15, s.time.Format("15"))
+	}
+	buf.WriteString("</svg>\n")
+	return buf.Flush()
+}
+
+//WriteHTML writes a page with the SVG timeline and a table of when each program started
+func (t *Timeline) WriteHTML(w io.Writer) error {
+	title := "Timeline"
+	if len(t.samples) > 0 {
+		title = "Timeline for " + t.samples[0].time.Format("Monday 2 January 2006")
+	}
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>%s</title></head>\n<body>\n<h1>%s</h1>\n", title, title)
+	if err := t.WriteSVG(w); err != nil {
+		return err
+	}
+	fmt.Fprint(w, "<table>\n<tr><th>Time</th><th>Program</th></tr>\n")
+	for _, r := range t.runs(func(s sample) interface{} { return s.program }) {
+		s := t.samples[r.start]
+		fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td></tr>\n", s.time.Format("15:04"), html.EscapeString(s.program))
+	}
+	_, err := fmt.Fprint(w, "</table>\n</body>\n</html>\n")
+	return err
+}
+
+//WritePNG draws a strip for each fixture, without labels
+func (t *Timeline) WritePNG(w io.Writer) error {
+	img := image.NewRGBA(image.Rect(0, 0, len(t.samples), rowHeight*len(t.Fixtures)))
+	for x, s := range t.samples {
+		for f, c := range s.colors {
+			r, g, b := default_loop.SRGB(c)
+			for y := f * rowHeight; y < (f+1)*rowHeight; y++ {
+				img.Set(x, y, color.RGBA{R: r, G: g, B: b, A: 0xFF})
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+//Save writes the timeline to path as SVG, HTML or PNG depending on its extension
+func (t *Timeline) Save(path string) error {
+	var write func(w io.Writer) error
+	switch filepath.Ext(path) {
+	case ".svg":
+		write = t.WriteSVG
+	case ".html":
+		write = t.WriteHTML
+	case ".png":
+		write = t.WritePNG
+	default:
+		return fmt.Errorf("Unknown timeline format: %s", filepath.Ext(path))
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,222 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rltvty/go-home/dmx/clock"
+	"github.com/rltvty/go-home/dmx/control"
+	"github.com/rltvty/go-home/dmx/default_loop"
+	"github.com/rltvty/go-home/logwrapper"
+)
+
+const defaultInterval = 10 * time.Second
+const defaultOutputInterval = 15 * time.Minute
+const defaultResumeFade = 2 * time.Second
+const defaultResumeWithin = time.Minute
+
+//Store saves the controller's mode, overrides and the last output of each fixture to Path, and restores them
+//on start, so a restart carries on where the service left off
+type Store struct {
+	Path string
+	//Interval is how often the state is saved, if the mode or overrides have changed
+	Interval time.Duration
+	//OutputInterval is how often the state is saved if only the outputs have changed.  They change on every frame
+	//of a fade, so saving them every Interval would wear out the SD card.
+	OutputInterval time.Duration
+	//ResumeFade is how long the fixtures take to fade from their saved output to the live color after a restart
+	ResumeFade time.Duration
+	//ResumeWithin is how recently the outputs must have been saved to fade from them, older outputs are skipped
+	//since the lights will have moved on
+	ResumeWithin time.Duration
+
+	mu        sync.Mutex
+	saved     []byte
+	settings  []byte
+	resumed   map[string]default_loop.Color
+	resumedAt time.Time
+}
+
+//New creates a store saving to path, with optional options
+func New(path string, options ...func(*Store)) *Store {
+	store := Store{
+		Path:           path,
+		Interval:       defaultInterval,
+		OutputInterval: defaultOutputInterval,
+		ResumeFade:     defaultResumeFade,
+		ResumeWithin:   defaultResumeWithin,
+	}
+	store.SetOptions(options...)
+
+	return &store
+}
+
+// SetOptions takes one or more option function and applies them in order to Store.
+func (s *Store) SetOptions(options ...func(*Store)) {
+	for _, opt := range options {
+		opt(s)
+	}
+}
+
+//Load restores the saved state into the controller, if there is any, and starts the fade from the saved outputs
+//if they were saved within ResumeWithin
+func (s *Store) Load(controller *control.Controller, now time.Time) error {
+	b, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var snapshot control.Snapshot
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return err
+	}
+	controller.Restore(snapshot, now)
+	content, err := contentOf(snapshot)
+	if err != nil {
+		return err
+	}
+	settings, err := settingsOf(snapshot)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = content
+	s.settings = settings
+	if now.Sub(snapshot.Saved) <= s.ResumeWithin {
+		s.resumed = snapshot.Outputs
+		s.resumedAt = now
+	}
+	return nil
+}
+
+//contentOf is a snapshot without the time it was taken, to tell whether anything has changed
+func contentOf(snapshot control.Snapshot) ([]byte, error) {
+	snapshot.Saved = time.Time{}
+	return json.Marshal(snapshot)
+}
+
+//settingsOf is the mode and overrides of a snapshot, without the outputs
+func settingsOf(snapshot control.Snapshot) ([]byte, error) {
+	return json.Marshal(control.Snapshot{Mode: snapshot.Mode, Overrides: snapshot.Overrides})
+}
+
+//Save writes the controller's state, unless it is the same as last saved
+func (s *Store) Save(controller *control.Controller, now time.Time) error {
+	return s.save(controller, now, true)
+}
+
+//SaveChanges writes the controller's state if the mode or overrides have changed since it was last saved,
+//changed outputs alone aren't written
+func (s *Store) SaveChanges(controller *control.Controller, now time.Time) error {
+	return s.save(controller, now, false)
+}
+
+func (s *Store) save(controller *control.Controller, now time.Time, outputs bool) error {
+	snapshot := controller.Snapshot(now)
+	content, err := contentOf(snapshot)
+	if err != nil {
+		return err
+	}
+	settings, err := settingsOf(snapshot)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if bytes.Equal(settings, s.settings) && (!outputs || bytes.Equal(content, s.saved)) {
+		return nil
+	}
+	b, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := WriteFile(s.Path, b); err != nil {
+		return err
+	}
+	s.saved = content
+	s.settings = settings
+	return nil
+}
+
+//Run saves the mode and overrides every Interval if they have changed, and the outputs every OutputInterval,
+//until quit is closed, saving once more before it returns
+func (s *Store) Run(controller *control.Controller, clk clock.Clock, quit chan int) {
+	log := logwrapper.GetInstance()
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	outputTicker := time.NewTicker(s.OutputInterval)
+	defer outputTicker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.SaveChanges(controller, clk.Now()); err != nil {
+				log.InfoError("Unable to save state", err)
+			}
+		case <-outputTicker.C:
+			if err := s.Save(controller, clk.Now()); err != nil {
+				log.InfoError("Unable to save state", err)
+			}
+		case <-quit:
+			if err := s.Save(controller, clk.Now()); err != nil {
+				log.InfoError("Unable to save state", err)
+			}
+			return
+		}
+	}
+}
+
+//Output fades a fixture from its saved output to color for ResumeFade after the state was loaded, so the lights
+//don't jump when the service restarts
+func (s *Store) Output(fixture string, color default_loop.Color, now time.Time) default_loop.Color {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, ok := s.resumed[fixture]
+	if !ok {
+		return color
+	}
+	return default_loop.Transition{
+		From:     from,
+		To:       color,
+		Start:    s.resumedAt,
+		Duration: s.ResumeFade,
+		Easing:   default_loop.Linear,
+	}.At(now)
+}
+
+//WriteFile writes b to path through a temporary file, synced to disk before it replaces path, so a crash or
+//power cut can't leave half of it.  The directory is created if it doesn't exist.
+func WriteFile(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(b); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,132 @@
+package state_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/rltvty/go-home/dmx/clock"
+	"github.com/rltvty/go-home/dmx/control"
+	"github.com/rltvty/go-home/dmx/default_loop"
+	. "github.com/rltvty/go-home/dmx/state"
+)
+
+var _ = Describe("State", func() {
+	now := time.Date(2019, 6, 21, 22, 0, 0, 0, time.UTC)
+	white := default_loop.Color{White: 200}
+	var dir, path string
+	var controller *control.Controller
+
+	newController := func() *control.Controller {
+		c, err := control.New([]string{"sink", "shower"}, map[string][]string{})
+		Expect(err).NotTo(HaveOccurred())
+		return c
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "state")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "state.json")
+		controller = newController()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("should start afresh without saved state", func() {
+		Expect(New(path).Load(controller, now)).To(Succeed())
+		Expect(controller.Status(now).Fixtures[0].Override).To(BeNil())
+	})
+
+	It("should restore the mode and overrides", func() {
+		controller.SetMode("guests")
+		controller.SetColor("sink", white, 0, now)
+		Expect(New(path).Save(controller, now)).To(Succeed())
+
+		restored := newController()
+		Expect(New(path).Load(restored, now.Add(time.Minute))).To(Succeed())
+		Expect(restored.Mode()).To(Equal("guests"))
+		Expect(restored.Status(now).Fixtures[0].Override.Color).To(Equal(white))
+	})
+
+	It("should only write when the state changes", func() {
+		store := New(path)
+		Expect(store.Save(controller, now)).To(Succeed())
+		Expect(os.Remove(path)).To(Succeed())
+		Expect(store.Save(controller, now)).To(Succeed())
+		Expect(path).NotTo(BeAnExistingFile())
+		controller.SetMode("away")
+		Expect(store.Save(controller, now)).To(Succeed())
+		Expect(path).To(BeAnExistingFile())
+	})
+
+	It("should only write changed outputs when asked to", func() {
+		store := New(path)
+		Expect(store.Save(controller, now)).To(Succeed())
+		Expect(os.Remove(path)).To(Succeed())
+		controller.ReportOutput("sink", white)
+		Expect(store.SaveChanges(controller, now)).To(Succeed())
+		Expect(path).NotTo(BeAnExistingFile())
+		controller.SetMode("away")
+		Expect(store.SaveChanges(controller, now)).To(Succeed())
+		Expect(path).To(BeAnExistingFile())
+
+		Expect(os.Remove(path)).To(Succeed())
+		controller.ReportOutput("sink", default_loop.Color{})
+		Expect(store.SaveChanges(controller, now)).To(Succeed())
+		Expect(path).NotTo(BeAnExistingFile())
+		Expect(store.Save(controller, now)).To(Succeed())
+		Expect(path).To(BeAnExistingFile())
+	})
+
+	It("should create the directory it saves to", func() {
+		path = filepath.Join(dir, "missing", "state.json")
+		Expect(New(path).Save(controller, now)).To(Succeed())
+		Expect(New(path).Load(newController(), now)).To(Succeed())
+		Expect(path).To(BeAnExistingFile())
+	})
+
+	It("should fade from the saved output after a restart", func() {
+		controller.ReportOutput("sink", white)
+		Expect(New(path).Save(controller, now)).To(Succeed())
+
+		store := New(path)
+		Expect(store.Load(newController(), now)).To(Succeed())
+		Expect(store.Output("sink", default_loop.Color{}, now)).To(Equal(white))
+		Expect(store.Output("sink", default_loop.Color{}, now.Add(time.Second))).To(Equal(default_loop.Color{White: 100}))
+		Expect(store.Output("sink", default_loop.Color{}, now.Add(2*time.Second))).To(Equal(default_loop.Color{}))
+		Expect(store.Output("shower", default_loop.Color{Red: 10}, now)).To(Equal(default_loop.Color{Red: 10}))
+	})
+
+	It("should not fade from outputs saved long ago", func() {
+		controller.ReportOutput("sink", white)
+		Expect(New(path).Save(controller, now)).To(Succeed())
+
+		store := New(path)
+		later := now.Add(12 * time.Hour)
+		Expect(store.Load(newController(), later)).To(Succeed())
+		Expect(store.Output("sink", default_loop.Color{Red: 10}, later)).To(Equal(default_loop.Color{Red: 10}))
+	})
+
+	It("should save when it stops", func() {
+		store := New(path, func(s *Store) {
+			s.Interval = time.Hour
+		})
+		quit := make(chan int)
+		done := make(chan int)
+		go func() {
+			store.Run(controller, clock.NewFixed(now), quit)
+			close(done)
+		}()
+		controller.SetMode("away")
+		close(quit)
+		Eventually(done).Should(BeClosed())
+		Expect(path).To(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,203 @@
+package zone
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+//FixtureJSON is a fixture patched on a node
+type FixtureJSON struct {
+	Name    string `json:"name"`
+	Profile string `json:"profile"`
+	Address int    `json:"address"`
+}
+
+//NodeJSON is an Art-Net or E1.31 node, with the fixtures on its universe
+type NodeJSON struct {
+	Name     string        `json:"name"`
+	IP       string        `json:"ip"`
+	Universe uint8         `json:"universe"`
+	Fixtures []FixtureJSON `json:"fixtures"`
+}
+
+//Zone is a room or part of one, with fixtures that run the same program
+type Zone struct {
+	Fixtures []string `json:"fixtures"`
+	//Program is the program file the zone runs, and Schedule the schedule, neither runs -program or -schedule.
+	//Paths are relative to the zone config.
+	Program  string `json:"program,omitempty"`
+	Schedule string `json:"schedule,omitempty"`
+	//Alarm is whether the wake alarm lights the zone, it does unless set to false
+	Alarm *bool `json:"alarm,omitempty"`
+}
+
+//HasAlarm returns whether the wake alarm lights the zone
+func (z Zone) HasAlarm() bool {
+	return z.Alarm == nil || *z.Alarm
+}
+
+//Config is the nodes, the zones their fixtures are in and groups of zones
+type Config struct {
+	Nodes  []NodeJSON          `json:"nodes"`
+	Zones  map[string]Zone     `json:"zones"`
+	Groups map[string][]string `json:"groups"`
+}
+
+//Bathroom is the default config, the bathroom with the sink and shower as separate zones
+func Bathroom() *Config {
+	return &Config{
+		Nodes: []NodeJSON{
+			{Name: "sink", IP: "10.10.10.20", Universe: 1, Fixtures: []FixtureJSON{{Name: "sink", Profile: "rgbwau-dimmer", Address: 1}}},
+			{Name: "shower", IP: "10.10.10.21", Universe: 0, Fixtures: []FixtureJSON{{Name: "shower", Profile: "rgbwau-dimmer", Address: 1}}},
+		},
+		Zones: map[string]Zone{
+			"bathroom-sink":   {Fixtures: []string{"sink"}},
+			"bathroom-shower": {Fixtures: []string{"shower"}},
+		},
+		Groups: map[string][]string{
+			"bathroom": {"bathroom-sink", "bathroom-shower"},
+		},
+	}
+}
+
+//Load reads and checks a JSON zone config, resolving program and schedule paths relative to it
+func Load(path string) (*Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var config Config
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	for name, z := range config.Zones {
+		z.Program = resolve(path, z.Program)
+		z.Schedule = resolve(path, z.Schedule)
+		config.Zones[name] = z
+	}
+	return &config, nil
+}
+
+func resolve(config string, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(config), path)
+}
+
+//Validate checks that every fixture is in exactly one zone, and that the names are all different
+func (c *Config) Validate() error {
+	used := map[string]string{}
+	use := func(name string, kind string) error {
+		if other, ok := used[name]; ok {
+			return fmt.Errorf("%s %s has the same name as a %s", kind, name, other)
+		}
+		used[name] = strings.ToLower(kind)
+		return nil
+	}
+
+	//nodes are named separately from fixtures, zones and groups, since a node often shares its fixture's name
+	nodes := map[string]bool{}
+	for _, node := range c.Nodes {
+		if nodes[node.Name] {
+			return fmt.Errorf("Node %s has the same name as a node", node.Name)
+		}
+		nodes[node.Name] = true
+		if net.ParseIP(node.IP) == nil {
+			return fmt.Errorf("Node %s has an invalid IP: %s", node.Name, node.IP)
+		}
+		for _, f := range node.Fixtures {
+			if err := use(f.Name, "Fixture"); err != nil {
+				return err
+			}
+		}
+	}
+
+	zoneOf := map[string]string{}
+	for _, name := range c.Names() {
+		z := c.Zones[name]
+		if err := use(name, "Zone"); err != nil {
+			return err
+		}
+		if z.Program != "" && z.Schedule != "" {
+			return fmt.Errorf("Zone %s can't have both a program and a schedule", name)
+		}
+		for _, f := range z.Fixtures {
+			if used[f] != "fixture" {
+				return fmt.Errorf("Zone %s contains unknown fixture %s", name, f)
+			}
+			if other, ok := zoneOf[f]; ok {
+				return fmt.Errorf("Fixture %s is in zones %s and %s", f, other, name)
+			}
+			zoneOf[f] = name
+		}
+	}
+	for _, node := range c.Nodes {
+		for _, f := range node.Fixtures {
+			if _, ok := zoneOf[f.Name]; !ok {
+				return fmt.Errorf("Fixture %s isn't in a zone", f.Name)
+			}
+		}
+	}
+
+	for group, zones := range c.Groups {
+		if err := use(group, "Group"); err != nil {
+			return err
+		}
+		for _, z := range zones {
+			if _, ok := c.Zones[z]; !ok {
+				return fmt.Errorf("Group %s contains unknown zone %s", group, z)
+			}
+		}
+	}
+	return nil
+}
+
+//Names lists the zone names in order
+func (c *Config) Names() []string {
+	names := []string{}
+	for name := range c.Zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//ZoneOf maps each fixture to its zone
+func (c *Config) ZoneOf() map[string]string {
+	zoneOf := map[string]string{}
+	for name, z := range c.Zones {
+		for _, f := range z.Fixtures {
+			zoneOf[f] = name
+		}
+	}
+	return zoneOf
+}
+
+//Targets maps each zone and group to its fixtures, so they can be addressed like groups of fixtures
+func (c *Config) Targets() map[string][]string {
+	targets := map[string][]string{}
+	for name, z := range c.Zones {
+		targets[name] = append([]string{}, z.Fixtures...)
+	}
+	for group, zones := range c.Groups {
+		fixtures := []string{}
+		for _, z := range zones {
+			fixtures = append(fixtures, c.Zones[z].Fixtures...)
+		}
+		targets[group] = fixtures
+	}
+	return targets
+}
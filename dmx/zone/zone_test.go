@@ -0,0 +1,109 @@
+package zone_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/rltvty/go-home/dmx/zone"
+)
+
+var _ = Describe("Zone", func() {
+	var config *Config
+
+	BeforeEach(func() {
+		config = Bathroom()
+	})
+
+	It("should split the bathroom into the sink and shower", func() {
+		Expect(config.Validate()).To(Succeed())
+		Expect(config.Names()).To(Equal([]string{"bathroom-shower", "bathroom-sink"}))
+		Expect(config.ZoneOf()).To(Equal(map[string]string{"sink": "bathroom-sink", "shower": "bathroom-shower"}))
+		Expect(config.Targets()).To(Equal(map[string][]string{
+			"bathroom-sink":   {"sink"},
+			"bathroom-shower": {"shower"},
+			"bathroom":        {"sink", "shower"},
+		}))
+	})
+
+	It("should light zones with the alarm unless turned off", func() {
+		off := false
+		Expect(Zone{}.HasAlarm()).To(BeTrue())
+		Expect(Zone{Alarm: &off}.HasAlarm()).To(BeFalse())
+	})
+
+	Describe("Validate", func() {
+		It("should reject fixtures in two zones", func() {
+			config.Zones["bathroom-sink"] = Zone{Fixtures: []string{"sink", "shower"}}
+			Expect(config.Validate()).To(MatchError("Fixture shower is in zones bathroom-shower and bathroom-sink"))
+		})
+
+		It("should reject fixtures in no zone", func() {
+			delete(config.Zones, "bathroom-shower")
+			config.Groups = nil
+			Expect(config.Validate()).To(MatchError("Fixture shower isn't in a zone"))
+		})
+
+		It("should reject unknown fixtures and zones", func() {
+			config.Zones["hallway"] = Zone{Fixtures: []string{"hallway"}}
+			Expect(config.Validate()).To(MatchError("Zone hallway contains unknown fixture hallway"))
+
+			delete(config.Zones, "hallway")
+			config.Groups["upstairs"] = []string{"bedroom"}
+			Expect(config.Validate()).To(MatchError("Group upstairs contains unknown zone bedroom"))
+		})
+
+		It("should reject names used twice", func() {
+			config.Groups["sink"] = []string{"bathroom-sink"}
+			Expect(config.Validate()).To(MatchError("Group sink has the same name as a fixture"))
+		})
+
+		It("should reject a zone with both a program and a schedule", func() {
+			config.Zones["bathroom-sink"] = Zone{Fixtures: []string{"sink"}, Program: "a.json", Schedule: "b.json"}
+			Expect(config.Validate()).To(MatchError("Zone bathroom-sink can't have both a program and a schedule"))
+		})
+
+		It("should reject nodes with the same name", func() {
+			config.Nodes[1].Name = "sink"
+			Expect(config.Validate()).To(MatchError("Node sink has the same name as a node"))
+		})
+
+		It("should reject invalid IPs", func() {
+			config.Nodes[0].IP = "sink.local"
+			Expect(config.Validate()).To(MatchError("Node sink has an invalid IP: sink.local"))
+		})
+	})
+
+	Describe("Load", func() {
+		It("should load the example zones, with paths relative to it", func() {
+			config, err := Load("../zones.json")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.Names()).To(Equal([]string{"bathroom-shower", "bathroom-sink", "bedroom", "hallway"}))
+			Expect(config.Zones["hallway"].Program).To(Equal(filepath.Join("..", "programs", "default.json")))
+			Expect(config.Zones["bedroom"].Schedule).To(Equal(filepath.Join("..", "programs", "schedule.json")))
+			Expect(config.Zones["hallway"].HasAlarm()).To(BeFalse())
+			Expect(config.Targets()["upstairs"]).To(Equal([]string{"hall-ceiling", "bed-left", "bed-right"}))
+		})
+
+		It("should reject invalid configs", func() {
+			dir, err := ioutil.TempDir("", "zone")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "zones.json")
+
+			Expect(ioutil.WriteFile(path, []byte(`{"rooms": {}}`), 0644)).To(Succeed())
+			_, err = Load(path)
+			Expect(err).To(HaveOccurred())
+
+			Expect(ioutil.WriteFile(path, []byte(`{"zones": {"hallway": {"fixtures": ["hallway"]}}}`), 0644)).To(Succeed())
+			_, err = Load(path)
+			Expect(err).To(MatchError("Zone hallway contains unknown fixture hallway"))
+
+			_, err = Load(filepath.Join(dir, "missing.json"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -1,6 +1,7 @@
 package netutils
 
 import (
+	"fmt"
 	"net"
 	"strings"
 
@@ -44,3 +45,31 @@ func GetConnectedIPV4s() []net.IP {
 	}
 	return ips
 }
+
+//GetIPV4Broadcast returns the directed broadcast address of the interface network that ip belongs to
+func GetIPV4Broadcast(ip net.IP) (net.IP, error) {
+	addresses, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, address := range addresses {
+		network, ok := address.(*net.IPNet)
+		if !ok || !network.IP.Equal(ip) {
+			continue
+		}
+		ipv4 := network.IP.To4()
+		mask := network.Mask
+		if ipv4 == nil {
+			continue
+		}
+		if len(mask) == net.IPv6len {
+			mask = mask[12:]
+		}
+		broadcast := make(net.IP, net.IPv4len)
+		for i := range ipv4 {
+			broadcast[i] = ipv4[i] | ^mask[i]
+		}
+		return broadcast, nil
+	}
+	return nil, fmt.Errorf("No interface found with ip %s", ip)
+}